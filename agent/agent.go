@@ -0,0 +1,249 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/datum-cloud/galactic-agent/api/local"
+	"github.com/datum-cloud/galactic-agent/api/remote"
+	"github.com/datum-cloud/galactic-agent/dispatch"
+	"github.com/datum-cloud/galactic-agent/health"
+	"github.com/datum-cloud/galactic-agent/metrics"
+	"github.com/datum-cloud/galactic-agent/srv6"
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
+	"github.com/datum-cloud/galactic-agent/srv6/routeegress"
+	"github.com/datum-cloud/galactic-common/util"
+)
+
+type Config struct {
+	// NodeID and Version identify the agent in presence announcements.
+	NodeID     string
+	Version    string
+	SRv6Net    string
+	SocketPath string
+	SocketMode os.FileMode
+	// SocketUID and SocketGID set the owner of the socket file, -1 leaves
+	// it unchanged.
+	SocketUID int
+	SocketGID int
+	AuthRules []local.Rule
+	// StorePath persists local registrations across restarts, empty
+	// disables it.
+	StorePath string
+	// CheckpointPath persists the egress routes received from the
+	// controller across restarts, empty disables it.
+	CheckpointPath string
+	// HTTPAddress serves metrics and health checks, empty disables it.
+	HTTPAddress string
+	// VPCTopic is subscribed to for every VPC with a local attachment, with
+	// remote.TopicVPC replaced by the hex VPC id. Empty disables it, the
+	// transport must implement remote.Subscriber otherwise.
+	VPCTopic  string
+	QueueSize int
+	QueueDir  string
+	// DispatchWorkers and DispatchQueueSize bound the concurrency of
+	// dataplane operations, see dispatch.Dispatcher.
+	DispatchWorkers   int
+	DispatchQueueSize int
+	// HeartbeatInterval defaults to DefaultHeartbeatInterval, negative
+	// disables heartbeats.
+	HeartbeatInterval time.Duration
+	ReconcileInterval time.Duration
+	StaleGracePeriod  time.Duration
+	// PendingRouteTTL bounds how long a route waits for the VRF of its
+	// attachment, see srv6.Reconciler.PendingTTL.
+	PendingRouteTTL time.Duration
+	RouteProtocol   netlink.RouteProtocol
+}
+
+func (c Config) validate() error {
+	if _, err := util.EncodeSRv6Endpoint(c.SRv6Net, "ffffffffffff", "ffff"); err != nil {
+		return fmt.Errorf("srv6_net invalid: %w", err)
+	}
+	// 0-4 are reserved by the kernel (unspec, redirect, kernel, boot, static)
+	if c.RouteProtocol <= 4 {
+		return fmt.Errorf("route_protocol invalid: %d", c.RouteProtocol)
+	}
+	return nil
+}
+
+// Agent connects the local API, the controller transport and the SRv6
+// dataplane of a node.
+type Agent struct {
+	config    Config
+	dataplane dataplane.Dataplane
+	transport remote.Transport
+
+	local      local.Local
+	remote     remote.Remote
+	reconciler srv6.Reconciler
+	dispatcher dispatch.Dispatcher
+	health     health.Health
+	resynced   atomic.Bool
+
+	routesMu sync.Mutex
+	routes   map[string]srv6.EgressSpec
+	versions map[string]uint64
+	// failed holds the routes whose last acknowledged outcome was a
+	// failure, so that the controller can redeliver their version
+	failed        map[string]struct{}
+	routesVersion uint64
+	// generation is that of the last SyncRequest sent and changed holds the
+	// generation at which a Route last changed every route, so that a
+	// snapshot does not undo changes it predates
+	generation uint64
+	changed    map[string]uint64
+	// checkpointDirty is signalled by updateRoutes for runCheckpoint.
+	checkpointDirty chan struct{}
+
+	// vpcs holds the local attachments (SRv6 endpoints) of every VPC.
+	vpcsMu sync.Mutex
+	vpcs   map[string]map[string]struct{}
+	// subscribeMu orders the VPC topic (un)subscriptions of attach and
+	// detach, which block on the broker and so are made without vpcsMu.
+	subscribeMu sync.Mutex
+}
+
+func New(config Config, dp dataplane.Dataplane, transport remote.Transport) (*Agent, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := transport.(remote.Subscriber); config.VPCTopic != "" && !ok {
+		return nil, errors.New("vpc topic: transport does not support subscriptions")
+	}
+
+	a := &Agent{
+		config:          config,
+		dataplane:       dp,
+		transport:       transport,
+		checkpointDirty: make(chan struct{}, 1),
+	}
+	a.reconciler = srv6.Reconciler{
+		Dataplane:     dp,
+		Interval:      config.ReconcileInterval,
+		GracePeriod:   config.StaleGracePeriod,
+		PendingTTL:    config.PendingRouteTTL,
+		Protocol:      config.RouteProtocol,
+		EgressHandler: a.egressEvent,
+	}
+	a.dispatcher = dispatch.Dispatcher{
+		Workers:   config.DispatchWorkers,
+		QueueSize: config.DispatchQueueSize,
+	}
+	a.local = local.Local{
+		SocketPath:        config.SocketPath,
+		SocketMode:        config.SocketMode,
+		SocketUID:         config.SocketUID,
+		SocketGID:         config.SocketGID,
+		Rules:             config.AuthRules,
+		RegisterHandler:   a.register,
+		DeregisterHandler: a.deregister,
+		DescribeHandler:   a.describe,
+		StorePath:         config.StorePath,
+	}
+	offline, err := proto.Marshal(a.presence(remote.Presence_OFFLINE))
+	if err != nil {
+		return nil, err
+	}
+	if will, ok := transport.(remote.LastWill); ok {
+		will.SetLastWill(offline)
+	}
+	a.remote = remote.Remote{
+		Transport:      transport,
+		QueueSize:      config.QueueSize,
+		QueueDir:       config.QueueDir,
+		Goodbye:        offline,
+		ConnectHandler: a.connect,
+		ReceiveHandler: a.receive,
+	}
+
+	a.health.AddReadinessCheck("grpc", func() error {
+		if !a.local.Serving() {
+			return errors.New("not serving")
+		}
+		return nil
+	})
+	a.health.AddReadinessCheck("transport", func() error {
+		if !transport.Connected() {
+			return errors.New("not connected")
+		}
+		return nil
+	})
+	a.health.AddReadinessCheck(routeegress.LoopbackDevice, func() error {
+		_, err := dp.LinkByName(routeegress.LoopbackDevice)
+		return err
+	})
+	a.health.AddReadinessCheck("resync", func() error {
+		if !a.resynced.Load() {
+			return errors.New("no snapshot received yet")
+		}
+		return nil
+	})
+	return a, nil
+}
+
+// Run serves the local API, the controller transport, the reconciler and, if
+// configured, the HTTP endpoints until ctx is done or one of them fails.
+func (a *Agent) Run(ctx context.Context) error {
+	if err := a.restore(); err != nil {
+		return fmt.Errorf("restore registrations: %w", err)
+	}
+	if err := a.restoreCheckpoint(); err != nil {
+		return fmt.Errorf("restore checkpoint: %w", err)
+	}
+	metrics.SetConnectedFunc(a.transport.Connected)
+
+	g, ctx := errgroup.WithContext(ctx)
+	if a.config.HTTPAddress != "" {
+		m := metrics.Server{
+			Address: a.config.HTTPAddress,
+			Handlers: map[string]http.Handler{
+				"/healthz": a.health.LivenessHandler(),
+				"/readyz":  a.health.ReadinessHandler(),
+			},
+		}
+		g.Go(func() error {
+			return m.Run(ctx)
+		})
+	}
+	if a.config.CheckpointPath != "" {
+		g.Go(func() error {
+			return a.runCheckpoint(ctx)
+		})
+	}
+	g.Go(func() error {
+		return a.reconciler.Run(ctx)
+	})
+	g.Go(func() error {
+		return a.dispatcher.Run(ctx)
+	})
+	if interval := a.config.HeartbeatInterval; interval >= 0 {
+		if interval == 0 {
+			interval = DefaultHeartbeatInterval
+		}
+		g.Go(func() error {
+			return a.runHeartbeat(ctx, interval)
+		})
+	}
+	g.Go(func() error {
+		return a.local.Serve(ctx)
+	})
+	g.Go(func() error {
+		return a.remote.Run(ctx)
+	})
+	err := g.Wait()
+	log.Printf("Shutdown")
+	return err
+}
@@ -0,0 +1,942 @@
+package agent_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/datum-cloud/galactic-agent/agent"
+	"github.com/datum-cloud/galactic-agent/api/local"
+	"github.com/datum-cloud/galactic-agent/api/remote"
+	"github.com/datum-cloud/galactic-agent/srv6"
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
+	"github.com/datum-cloud/galactic-agent/srv6/routeegress"
+	"github.com/datum-cloud/galactic-common/util"
+)
+
+const (
+	srv6Net       = "fc00::/56"
+	vpc           = "0000000004d2" // jU in base62
+	vpcAttachment = "002a"         // G in base62
+	vrfTable      = 10
+	segment       = "2607:ed40:ff00::1"
+)
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func sent(t *testing.T, transport *remote.Memory) []*remote.Envelope {
+	t.Helper()
+	var envelopes []*remote.Envelope
+	for _, payload := range transport.Sent() {
+		envelope := &remote.Envelope{}
+		if err := proto.Unmarshal(payload, envelope); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		envelopes = append(envelopes, envelope)
+	}
+	return envelopes
+}
+
+// newDataplane returns a node with the host interface and VRF of
+// vpc/vpcAttachment, but not of any other attachment.
+func newDataplane() (*dataplane.Fake, netlink.Link) {
+	dp := &dataplane.Fake{}
+	dp.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: routeegress.LoopbackDevice}})
+	host := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameHost("jU", "G")}}
+	dp.AddLink(host)
+	dp.AddLink(&netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameVRF("jU", "G")}, Table: vrfTable})
+	return dp, host
+}
+
+// start runs an agent until the returned stop function is called and
+// returns a client connected to its local API.
+func start(t *testing.T, config agent.Config, dp dataplane.Dataplane, transport remote.Transport) (local.LocalClient, func()) {
+	t.Helper()
+	a, err := agent.New(config, dp, transport)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	conn, err := grpc.NewClient("unix://"+config.SocketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		cancel()
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return local.NewLocalClient(conn), func() {
+		conn.Close() //nolint:errcheck
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}
+}
+
+// node is an agent started by run.
+type node struct {
+	dp        *dataplane.Fake
+	host      netlink.Link
+	transport *remote.Memory
+	client    local.LocalClient
+}
+
+// run starts an agent on a new dataplane, stops it at the end of the test
+// and waits until it is connected.
+func run(t *testing.T, config agent.Config) node {
+	t.Helper()
+	n := node{transport: &remote.Memory{}}
+	n.dp, n.host = newDataplane()
+	var stop func()
+	n.client, stop = start(t, config, n.dp, n.transport)
+	t.Cleanup(stop)
+	eventually(t, "connected", n.transport.Connected)
+	return n
+}
+
+func config(t *testing.T) agent.Config {
+	return agent.Config{
+		SRv6Net:       srv6Net,
+		SocketPath:    filepath.Join(t.TempDir(), "agent.sock"),
+		SocketMode:    0o600,
+		SocketUID:     -1,
+		SocketGID:     -1,
+		RouteProtocol: srv6.DefaultProtocol,
+	}
+}
+
+// endpoint returns the SRv6 endpoint of attachment in vpc.
+func endpoint(t *testing.T, attachment string) string {
+	t.Helper()
+	srv6_endpoint, err := util.EncodeSRv6Endpoint(srv6Net, vpc, attachment)
+	if err != nil {
+		t.Fatalf("EncodeSRv6Endpoint() error = %v", err)
+	}
+	return srv6_endpoint
+}
+
+func hasIngress(dp *dataplane.Fake, host netlink.Link, endpoint string) bool {
+	for _, route := range dp.Routes() {
+		encap, ok := route.Encap.(*netlink.SEG6LocalEncap)
+		if ok && encap.Action == nl.SEG6_LOCAL_ACTION_END_DT46 && encap.VrfTable == vrfTable &&
+			route.LinkIndex == host.Attrs().Index && route.Dst.IP.String() == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEgress(dp *dataplane.Fake, prefix, segment string) bool {
+	for _, route := range dp.Routes() {
+		encap, ok := route.Encap.(*netlink.SEG6Encap)
+		if ok && route.Table == vrfTable && route.Dst.String() == prefix &&
+			len(encap.Segments) == 1 && encap.Segments[0].String() == segment {
+			return true
+		}
+	}
+	return false
+}
+
+// route returns a route from the controller for network via segment.
+func route(srv6_endpoint, network string, status remote.Route_Status, version uint64) *remote.Route {
+	return &remote.Route{
+		Network:      network,
+		Srv6Endpoint: srv6_endpoint,
+		Srv6Segments: []string{segment},
+		Status:       status,
+		Version:      version,
+	}
+}
+
+func deliver(t *testing.T, transport *remote.Memory, envelope *remote.Envelope) {
+	t.Helper()
+	payload, err := proto.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if err := transport.Deliver(payload); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+}
+
+func deliverRoute(t *testing.T, transport *remote.Memory, route *remote.Route) {
+	t.Helper()
+	deliver(t, transport, &remote.Envelope{
+		Kind: &remote.Envelope_Route{Route: route},
+	})
+}
+
+func deliverSnapshot(t *testing.T, transport *remote.Memory, routes ...*remote.Route) {
+	t.Helper()
+	deliver(t, transport, &remote.Envelope{
+		Kind: &remote.Envelope_Snapshot{
+			Snapshot: &remote.Snapshot{Routes: routes},
+		},
+	})
+}
+
+// acks returns the acks sent for network.
+func acks(t *testing.T, transport *remote.Memory, network string) []*remote.Ack {
+	t.Helper()
+	var acks []*remote.Ack
+	for _, envelope := range sent(t, transport) {
+		if ack := envelope.GetAck(); ack != nil && ack.GetNetwork() == network {
+			acks = append(acks, ack)
+		}
+	}
+	return acks
+}
+
+// unreachable is a Transport that never connects, like a node whose
+// controller is down.
+type unreachable struct{}
+
+func (unreachable) Run(ctx context.Context, _ func([]byte), _ func()) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (unreachable) Send([]byte) error { return remote.ErrNotConnected }
+
+func (unreachable) Connected() bool { return false }
+
+// register attaches vpc/vpcAttachment, so that routes for it are accepted.
+func register(t *testing.T, client local.LocalClient) {
+	t.Helper()
+	registerNetworks(t, client, vpcAttachment, "10.1.1.0/24")
+}
+
+func registerNetworks(t *testing.T, client local.LocalClient, attachment string, networks ...string) {
+	t.Helper()
+	if _, err := client.Register(context.Background(), &local.RegisterRequest{
+		Vpc:           vpc,
+		Vpcattachment: attachment,
+		Networks:      networks,
+	}, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+}
+
+func deregisterNetworks(t *testing.T, client local.LocalClient, attachment string, networks ...string) {
+	t.Helper()
+	if _, err := client.Deregister(context.Background(), &local.DeregisterRequest{
+		Vpc:           vpc,
+		Vpcattachment: attachment,
+		Networks:      networks,
+	}); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+}
+
+func registered(t *testing.T, transport *remote.Memory, endpoint string) []string {
+	t.Helper()
+	var networks []string
+	for _, envelope := range sent(t, transport) {
+		if register := envelope.GetRegister(); register != nil {
+			if register.GetSrv6Endpoint() != endpoint {
+				t.Errorf("Register srv6_endpoint = %s, want %s", register.GetSrv6Endpoint(), endpoint)
+			}
+			networks = append(networks, register.GetNetwork())
+		}
+	}
+	return networks
+}
+
+func TestAgent(t *testing.T) {
+	n := run(t, config(t))
+	ctx := context.Background()
+	srv6_endpoint := endpoint(t, vpcAttachment)
+	networks := []string{"10.1.1.0/24", "2001:db8:1::/64"}
+
+	reply, err := n.client.Register(ctx, &local.RegisterRequest{
+		Vpc:           vpc,
+		Vpcattachment: vpcAttachment,
+		Networks:      networks,
+	}, grpc.WaitForReady(true))
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if !reply.GetConfirmed() {
+		t.Errorf("Register() confirmed = false, want true")
+	}
+
+	t.Run("PublishesRegister", func(t *testing.T) {
+		var got []string
+		eventually(t, "register envelopes", func() bool {
+			got = registered(t, n.transport, srv6_endpoint)
+			return len(got) == len(networks)
+		})
+		for i, network := range networks {
+			if got[i] != network {
+				t.Errorf("Register network[%d] = %s, want %s", i, got[i], network)
+			}
+		}
+	})
+
+	t.Run("InstallsIngress", func(t *testing.T) {
+		eventually(t, "ingress route", func() bool {
+			return hasIngress(n.dp, n.host, srv6_endpoint)
+		})
+	})
+
+	t.Run("InstallsEgress", func(t *testing.T) {
+		deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 0))
+		eventually(t, "egress route", func() bool {
+			return hasEgress(n.dp, "10.2.2.0/24", segment)
+		})
+
+		describe, err := n.client.DescribeAttachment(ctx, &local.DescribeAttachmentRequest{
+			Vpc:           vpc,
+			Vpcattachment: vpcAttachment,
+		})
+		if err != nil {
+			t.Fatalf("DescribeAttachment() error = %v", err)
+		}
+		if got := describe.GetAttachment(); got.GetVrfTable() != vrfTable || len(got.GetRoutes()) != 1 {
+			t.Errorf("DescribeAttachment() = %v, want table %d with 1 route", got, vrfTable)
+		}
+	})
+}
+
+func TestAgentRestore(t *testing.T) {
+	cfg := config(t)
+	cfg.StorePath = filepath.Join(t.TempDir(), "registrations.json")
+	srv6_endpoint := endpoint(t, vpcAttachment)
+
+	dp, _ := newDataplane()
+	client, stop := start(t, cfg, dp, &remote.Memory{})
+	register(t, client)
+	stop()
+
+	// a fresh node: nothing installed, nothing announced
+	dp, host := newDataplane()
+	transport := &remote.Memory{}
+	client, stop = start(t, cfg, dp, transport)
+	defer stop()
+
+	eventually(t, "restored ingress route", func() bool {
+		return hasIngress(dp, host, srv6_endpoint)
+	})
+	eventually(t, "restored register envelopes", func() bool {
+		return len(registered(t, transport, srv6_endpoint)) == 1
+	})
+	reply, err := client.ListAttachments(context.Background(), &local.ListAttachmentsRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		t.Fatalf("ListAttachments() error = %v", err)
+	}
+	if got := reply.GetAttachments(); len(got) != 1 || got[0].GetVpc() != vpc || got[0].GetVpcattachment() != vpcAttachment {
+		t.Errorf("ListAttachments() = %v, want %s/%s", got, vpc, vpcAttachment)
+	}
+}
+
+func TestAgentCheckpoint(t *testing.T) {
+	cfg := config(t)
+	cfg.CheckpointPath = filepath.Join(t.TempDir(), "routes.json")
+	cfg.StorePath = filepath.Join(t.TempDir(), "registrations.json")
+	srv6_endpoint := endpoint(t, vpcAttachment)
+
+	dp, _ := newDataplane()
+	transport := &remote.Memory{}
+	client, stop := start(t, cfg, dp, transport)
+	register(t, client)
+	eventually(t, "connected", transport.Connected)
+	deliverRoute(t, transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 0))
+	eventually(t, "egress route", func() bool {
+		return hasEgress(dp, "10.2.2.0/24", segment)
+	})
+	stop()
+
+	// a rebooted node whose controller is down
+	dp, _ = newDataplane()
+	_, stop = start(t, cfg, dp, unreachable{})
+	eventually(t, "restored egress route", func() bool {
+		return hasEgress(dp, "10.2.2.0/24", segment)
+	})
+	stop()
+
+	// the controller's snapshot replaces the checkpoint
+	transport = &remote.Memory{}
+	_, stop = start(t, cfg, dp, transport)
+	defer stop()
+	eventually(t, "connected", transport.Connected)
+	deliverSnapshot(t, transport, route(srv6_endpoint, "10.3.3.0/24", remote.Route_ADD, 0))
+	eventually(t, "reconciled egress routes", func() bool {
+		return hasEgress(dp, "10.3.3.0/24", segment) && !hasEgress(dp, "10.2.2.0/24", segment)
+	})
+}
+
+func TestAgentCheckpointCorrupt(t *testing.T) {
+	cfg := config(t)
+	cfg.CheckpointPath = filepath.Join(t.TempDir(), "routes.json")
+	if err := os.WriteFile(cfg.CheckpointPath, []byte(`{"routes": [`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	n := run(t, cfg)
+	register(t, n.client)
+
+	deliverSnapshot(t, n.transport, route(endpoint(t, vpcAttachment), "10.3.3.0/24", remote.Route_ADD, 0))
+	eventually(t, "egress route", func() bool {
+		return hasEgress(n.dp, "10.3.3.0/24", segment)
+	})
+}
+
+func TestAgentRouteVersions(t *testing.T) {
+	n := run(t, config(t))
+	register(t, n.client)
+	srv6_endpoint := endpoint(t, vpcAttachment)
+	installed := func() bool {
+		return hasEgress(n.dp, "10.2.2.0/24", segment)
+	}
+
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 2))
+	eventually(t, "egress route", installed)
+
+	// a delayed delete and a redelivered add must not touch the route
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_DELETE, 1))
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_DELETE, 2))
+	time.Sleep(100 * time.Millisecond)
+	if !installed() {
+		t.Fatalf("egress route removed by a stale delete")
+	}
+
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_DELETE, 3))
+	eventually(t, "egress route removed", func() bool {
+		return !installed()
+	})
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 2))
+	time.Sleep(100 * time.Millisecond)
+	if installed() {
+		t.Errorf("egress route restored by a stale add")
+	}
+}
+
+func TestAgentAck(t *testing.T) {
+	n := run(t, config(t))
+	register(t, n.client)
+	srv6_endpoint := endpoint(t, vpcAttachment)
+
+	for _, network := range []string{"10.2.2.0/24", "not_a_prefix"} {
+		deliverRoute(t, n.transport, route(srv6_endpoint, network, remote.Route_ADD, 7))
+	}
+
+	var ack *remote.Ack
+	eventually(t, "ack", func() bool {
+		got := acks(t, n.transport, "10.2.2.0/24")
+		if len(got) == 0 {
+			return false
+		}
+		ack = got[0]
+		return true
+	})
+	if !ack.GetSuccess() || ack.GetVersion() != 7 || ack.GetSrv6Endpoint() != srv6_endpoint || ack.GetStatus() != remote.Route_ADD {
+		t.Errorf("Ack = %v, want success for version 7", ack)
+	}
+
+	eventually(t, "failure ack", func() bool {
+		got := acks(t, n.transport, "not_a_prefix")
+		if len(got) == 0 {
+			return false
+		}
+		ack = got[0]
+		return true
+	})
+	if ack.GetSuccess() || ack.GetError() == "" {
+		t.Errorf("Ack = %v, want failure with error", ack)
+	}
+}
+
+func TestAgentPresence(t *testing.T) {
+	cfg := config(t)
+	cfg.NodeID = "node-1"
+	cfg.Version = "v1.2.3"
+	dp, _ := newDataplane()
+	transport := &remote.Memory{}
+	_, stop := start(t, cfg, dp, transport)
+
+	presence := func(envelope *remote.Envelope) *remote.Presence {
+		p := envelope.GetPresence()
+		if p.GetNodeId() != cfg.NodeID || p.GetSrv6Net() != srv6Net || p.GetVersion() != cfg.Version {
+			t.Errorf("Presence = %v, want node %s at %s", p, cfg.NodeID, cfg.Version)
+		}
+		return p
+	}
+
+	eventually(t, "online presence", func() bool {
+		envelopes := sent(t, transport)
+		return len(envelopes) > 0 && envelopes[0].GetPresence() != nil
+	})
+	if p := presence(sent(t, transport)[0]); p.GetStatus() != remote.Presence_ONLINE {
+		t.Errorf("Presence status = %s, want ONLINE", p.GetStatus())
+	}
+
+	will := &remote.Envelope{}
+	if err := proto.Unmarshal(transport.LastWill(), will); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if p := presence(will); p.GetStatus() != remote.Presence_OFFLINE {
+		t.Errorf("last will status = %s, want OFFLINE", p.GetStatus())
+	}
+
+	stop()
+	envelopes := sent(t, transport)
+	if p := presence(envelopes[len(envelopes)-1]); p.GetStatus() != remote.Presence_OFFLINE {
+		t.Errorf("Presence status on shutdown = %s, want OFFLINE", p.GetStatus())
+	}
+}
+
+func TestAgentHeartbeat(t *testing.T) {
+	cfg := config(t)
+	cfg.NodeID = "node-1"
+	cfg.HeartbeatInterval = 10 * time.Millisecond
+	n := run(t, cfg)
+	srv6_endpoint := endpoint(t, vpcAttachment)
+	// the VRF of this attachment does not exist
+	missing := endpoint(t, "002b")
+	registerNetworks(t, n.client, vpcAttachment, "10.1.1.0/24")
+	registerNetworks(t, n.client, "002b", "10.1.9.0/24")
+	// addresses in the digest are canonical whatever the controller sent
+	deliverRoute(t, n.transport, route(strings.ToUpper(srv6_endpoint), "10.2.2.0/24", remote.Route_ADD, 0))
+	deliverRoute(t, n.transport, route(missing, "10.3.3.0/24", remote.Route_ADD, 0))
+
+	sum := func(lines ...string) string {
+		slices.Sort(lines)
+		h := sha256.New()
+		for _, line := range lines {
+			h.Write([]byte(line + "\n"))
+		}
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	// only the installed route is reported
+	want := &remote.Heartbeat{
+		NodeId:              cfg.NodeID,
+		Registrations:       2,
+		RegistrationsDigest: sum(srv6_endpoint+" 10.1.1.0/24", missing+" 10.1.9.0/24"),
+		EgressRoutes:        1,
+		EgressRoutesDigest:  sum(srv6_endpoint + " 10.2.2.0/24 " + segment),
+	}
+	eventually(t, "heartbeat", func() bool {
+		for _, envelope := range sent(t, n.transport) {
+			if proto.Equal(envelope.GetHeartbeat(), want) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestAgentResync(t *testing.T) {
+	cfg := config(t)
+	cfg.NodeID = "node-1"
+	n := run(t, cfg)
+	register(t, n.client)
+	srv6_endpoint := endpoint(t, vpcAttachment)
+
+	count := func() (registers, syncRequests int) {
+		for _, envelope := range sent(t, n.transport) {
+			if envelope.GetRegister().GetSrv6Endpoint() == srv6_endpoint {
+				registers++
+			}
+			if envelope.GetSyncRequest() != nil {
+				syncRequests++
+			}
+		}
+		return registers, syncRequests
+	}
+	eventually(t, "register", func() bool {
+		registers, _ := count()
+		return registers == 1
+	})
+
+	deliver(t, n.transport, &remote.Envelope{
+		Kind: &remote.Envelope_Resync{Resync: &remote.Resync{NodeId: "node-2"}},
+	})
+	time.Sleep(100 * time.Millisecond)
+	if registers, syncRequests := count(); registers != 1 || syncRequests != 1 {
+		t.Fatalf("resync of another node: registers = %d, sync requests = %d, want 1 and 1", registers, syncRequests)
+	}
+
+	deliver(t, n.transport, &remote.Envelope{
+		Kind: &remote.Envelope_Resync{Resync: &remote.Resync{NodeId: cfg.NodeID}},
+	})
+	eventually(t, "re-announced registrations", func() bool {
+		registers, syncRequests := count()
+		return registers == 2 && syncRequests == 2
+	})
+}
+
+func TestAgentVPCTopic(t *testing.T) {
+	cfg := config(t)
+	cfg.NodeID = "node-1"
+	cfg.VPCTopic = "galactic/{node}/vpc/{vpc}/routes"
+	n := run(t, cfg)
+
+	want := []string{"galactic/node-1/vpc/" + vpc + "/routes"}
+	for _, attachment := range []string{vpcAttachment, "002b"} {
+		registerNetworks(t, n.client, attachment, "10.1.1.0/24")
+		if got := n.transport.Topics(); !slices.Equal(got, want) {
+			t.Errorf("Topics() = %v, want %v", got, want)
+		}
+	}
+
+	// the topic is kept until the last attachment of the VPC is gone
+	for i, attachment := range []string{vpcAttachment, "002b"} {
+		deregisterNetworks(t, n.client, attachment, "10.1.1.0/24")
+		if i == 1 {
+			want = nil
+		}
+		if got := n.transport.Topics(); !slices.Equal(got, want) {
+			t.Errorf("Topics() = %v, want %v", got, want)
+		}
+	}
+
+	cfg.SocketPath = filepath.Join(t.TempDir(), "agent.sock")
+	if _, err := agent.New(cfg, n.dp, unreachable{}); err == nil {
+		t.Errorf("New() with a transport without subscriptions succeeded")
+	}
+}
+
+// slowSubscriber blocks subscriptions until release is closed.
+type slowSubscriber struct {
+	*remote.Memory
+	release chan struct{}
+}
+
+func (s slowSubscriber) Subscribe(topic string) error {
+	<-s.release
+	return s.Memory.Subscribe(topic)
+}
+
+func TestAgentVPCTopicSlowSubscribe(t *testing.T) {
+	cfg := config(t)
+	cfg.VPCTopic = "galactic/vpc/{vpc}/routes"
+	dp, _ := newDataplane()
+	transport := slowSubscriber{Memory: &remote.Memory{}, release: make(chan struct{})}
+	client, stop := start(t, cfg, dp, transport)
+	defer stop()
+	eventually(t, "connected", transport.Connected)
+
+	registered := make(chan error, 1)
+	go func() {
+		_, err := client.Register(context.Background(), &local.RegisterRequest{
+			Vpc:           vpc,
+			Vpcattachment: vpcAttachment,
+			Networks:      []string{"10.1.1.0/24"},
+		}, grpc.WaitForReady(true))
+		registered <- err
+	}()
+
+	// routes of the attachment are applied while its subscription blocks
+	eventually(t, "egress route", func() bool {
+		deliverRoute(t, transport.Memory, route(endpoint(t, vpcAttachment), "10.2.2.0/24", remote.Route_ADD, 0))
+		return hasEgress(dp, "10.2.2.0/24", segment)
+	})
+
+	close(transport.release)
+	if err := <-registered; err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if got, want := transport.Topics(), []string{"galactic/vpc/" + vpc + "/routes"}; !slices.Equal(got, want) {
+		t.Errorf("Topics() = %v, want %v", got, want)
+	}
+}
+
+func TestAgentForeignRoutes(t *testing.T) {
+	n := run(t, config(t))
+	register(t, n.client)
+	outside, err := util.EncodeSRv6Endpoint("fd00::/56", vpc, vpcAttachment)
+	if err != nil {
+		t.Fatalf("EncodeSRv6Endpoint() error = %v", err)
+	}
+
+	deliverRoute(t, n.transport, route(endpoint(t, "002b"), "10.3.3.0/24", remote.Route_ADD, 0))
+	deliverSnapshot(t, n.transport,
+		route(endpoint(t, vpcAttachment), "10.2.2.0/24", remote.Route_ADD, 0),
+		route(outside, "10.4.4.0/24", remote.Route_ADD, 0),
+	)
+	eventually(t, "egress route", func() bool {
+		return hasEgress(n.dp, "10.2.2.0/24", segment)
+	})
+	time.Sleep(100 * time.Millisecond)
+	for _, prefix := range []string{"10.3.3.0/24", "10.4.4.0/24"} {
+		if hasEgress(n.dp, prefix, segment) {
+			t.Errorf("egress route %s of a foreign endpoint installed", prefix)
+		}
+	}
+	for _, envelope := range sent(t, n.transport) {
+		if ack := envelope.GetAck(); ack != nil && ack.GetNetwork() != "10.2.2.0/24" {
+			t.Errorf("Ack = %v for a foreign endpoint", ack)
+		}
+	}
+}
+
+func TestAgentRegisterRollback(t *testing.T) {
+	cfg := config(t)
+	cfg.QueueSize = 1
+	dp, host := newDataplane()
+	client, stop := start(t, cfg, dp, unreachable{})
+	defer stop()
+
+	// the second register envelope does not fit into the queue
+	if _, err := client.Register(context.Background(), &local.RegisterRequest{
+		Vpc:           vpc,
+		Vpcattachment: vpcAttachment,
+		Networks:      []string{"10.1.1.0/24", "10.1.2.0/24"},
+	}, grpc.WaitForReady(true)); err == nil {
+		t.Fatalf("Register() with a full queue succeeded")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if hasIngress(dp, host, endpoint(t, vpcAttachment)) {
+		t.Errorf("ingress route of a failed registration installed")
+	}
+	reply, err := client.ListAttachments(context.Background(), &local.ListAttachmentsRequest{})
+	if err != nil {
+		t.Fatalf("ListAttachments() error = %v", err)
+	}
+	if n := len(reply.GetAttachments()); n != 0 {
+		t.Errorf("ListAttachments() got %d attachments, want 0", n)
+	}
+}
+
+func TestAgentDeregisterNetworks(t *testing.T) {
+	n := run(t, config(t))
+	srv6_endpoint := endpoint(t, vpcAttachment)
+	registerNetworks(t, n.client, vpcAttachment, "10.1.1.0/24", "10.1.2.0/24")
+	eventually(t, "ingress route", func() bool {
+		return hasIngress(n.dp, n.host, srv6_endpoint)
+	})
+
+	deregisterNetworks(t, n.client, vpcAttachment, "10.1.1.0/24")
+	time.Sleep(100 * time.Millisecond)
+	if !hasIngress(n.dp, n.host, srv6_endpoint) {
+		t.Fatalf("ingress route removed while a network is still registered")
+	}
+	deregisterNetworks(t, n.client, vpcAttachment, "10.1.2.0/24")
+	eventually(t, "ingress route removed", func() bool {
+		return !hasIngress(n.dp, n.host, srv6_endpoint)
+	})
+}
+
+func TestAgentDeregisterRoutes(t *testing.T) {
+	cfg := config(t)
+	cfg.CheckpointPath = filepath.Join(t.TempDir(), "routes.json")
+	n := run(t, cfg)
+	register(t, n.client)
+	srv6_endpoint := endpoint(t, vpcAttachment)
+
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 1))
+	eventually(t, "egress route", func() bool {
+		return hasEgress(n.dp, "10.2.2.0/24", segment)
+	})
+
+	deregisterNetworks(t, n.client, vpcAttachment, "10.1.1.0/24")
+	eventually(t, "egress route removed", func() bool {
+		return !hasEgress(n.dp, "10.2.2.0/24", segment)
+	})
+	eventually(t, "route removed from the checkpoint", func() bool {
+		checkpoint, err := os.ReadFile(cfg.CheckpointPath)
+		return err == nil && !strings.Contains(string(checkpoint), "10.2.2.0/24")
+	})
+	// the controller's delete arrives after the deregistration
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_DELETE, 2))
+
+	// registered anew, the route is applied again at the same version
+	register(t, n.client)
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 1))
+	eventually(t, "egress route", func() bool {
+		return hasEgress(n.dp, "10.2.2.0/24", segment)
+	})
+}
+
+func TestAgentPendingRouteExpires(t *testing.T) {
+	cfg := config(t)
+	cfg.CheckpointPath = filepath.Join(t.TempDir(), "routes.json")
+	cfg.ReconcileInterval = 10 * time.Millisecond
+	cfg.PendingRouteTTL = time.Millisecond
+	n := run(t, cfg)
+
+	// the VRF of this attachment does not exist
+	registerNetworks(t, n.client, "002b", "10.1.1.0/24")
+	deliverRoute(t, n.transport, route(endpoint(t, "002b"), "10.2.2.0/24", remote.Route_ADD, 0))
+	eventually(t, "expired route removed from the checkpoint", func() bool {
+		checkpoint, err := os.ReadFile(cfg.CheckpointPath)
+		return err == nil && !strings.Contains(string(checkpoint), "10.2.2.0/24")
+	})
+}
+
+func TestAgentSnapshotVersions(t *testing.T) {
+	n := run(t, config(t))
+	register(t, n.client)
+	const other = "2607:ed40:ff01::1"
+	via := func(segment string, version uint64) *remote.Route {
+		r := route(endpoint(t, vpcAttachment), "10.2.2.0/24", remote.Route_ADD, version)
+		r.Srv6Segments = []string{segment}
+		return r
+	}
+
+	deliverRoute(t, n.transport, via(segment, 5))
+	eventually(t, "egress route", func() bool {
+		return hasEgress(n.dp, "10.2.2.0/24", segment)
+	})
+
+	// a snapshot taken before version 5 must not roll the route back, nor
+	// lower the version so that 5 is applied again
+	deliverSnapshot(t, n.transport, via(other, 4))
+	deliverRoute(t, n.transport, via(other, 5))
+	time.Sleep(100 * time.Millisecond)
+	if !hasEgress(n.dp, "10.2.2.0/24", segment) {
+		t.Fatalf("egress route replaced by an older snapshot")
+	}
+
+	deliverSnapshot(t, n.transport, via(other, 6))
+	eventually(t, "egress route from a newer snapshot", func() bool {
+		return hasEgress(n.dp, "10.2.2.0/24", other)
+	})
+}
+
+func TestAgentSnapshotGeneration(t *testing.T) {
+	n := run(t, config(t))
+	register(t, n.client)
+	srv6_endpoint := endpoint(t, vpcAttachment)
+	installed := func() bool {
+		return hasEgress(n.dp, "10.2.2.0/24", segment)
+	}
+	generation := func() uint64 {
+		var generation uint64
+		for _, envelope := range sent(t, n.transport) {
+			if r := envelope.GetSyncRequest(); r != nil {
+				generation = r.GetGeneration()
+			}
+		}
+		return generation
+	}
+	snapshot := func(generation uint64) {
+		deliver(t, n.transport, &remote.Envelope{
+			Kind: &remote.Envelope_Snapshot{
+				Snapshot: &remote.Snapshot{Generation: generation},
+			},
+		})
+	}
+
+	first := generation()
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 1))
+	eventually(t, "egress route", installed)
+
+	// the snapshot answering the SyncRequest sent before the route was
+	// added does not list it
+	snapshot(first)
+	time.Sleep(100 * time.Millisecond)
+	if !installed() {
+		t.Fatalf("egress route removed by a snapshot it is newer than")
+	}
+
+	deliver(t, n.transport, &remote.Envelope{
+		Kind: &remote.Envelope_Resync{Resync: &remote.Resync{}},
+	})
+	eventually(t, "sync request", func() bool {
+		return generation() > first
+	})
+	snapshot(generation())
+	eventually(t, "egress route removed", func() bool {
+		return !installed()
+	})
+
+	// its version was forgotten with it
+	deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 1))
+	eventually(t, "egress route", installed)
+}
+
+func TestAgentAckOnce(t *testing.T) {
+	srv6_endpoint := endpoint(t, vpcAttachment)
+	versions := func(transport *remote.Memory, network string) []uint64 {
+		var versions []uint64
+		for _, ack := range acks(t, transport, network) {
+			versions = append(versions, ack.GetVersion())
+		}
+		return versions
+	}
+
+	t.Run("NoOp", func(t *testing.T) {
+		n := run(t, config(t))
+		register(t, n.client)
+
+		// a new version of an unchanged route and the delete of a route
+		// that was never installed are acknowledged too
+		deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 1))
+		eventually(t, "ack of version 1", func() bool {
+			return len(versions(n.transport, "10.2.2.0/24")) == 1
+		})
+		deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 2))
+		deliverRoute(t, n.transport, route(srv6_endpoint, "10.3.3.0/24", remote.Route_DELETE, 3))
+		eventually(t, "acks", func() bool {
+			return slices.Equal(versions(n.transport, "10.2.2.0/24"), []uint64{1, 2}) &&
+				slices.Equal(versions(n.transport, "10.3.3.0/24"), []uint64{3})
+		})
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		cfg := config(t)
+		cfg.ReconcileInterval = 10 * time.Millisecond
+		n := run(t, cfg)
+		register(t, n.client)
+		n.dp.SetErr("RouteReplace", errors.New("route failed"))
+		success := func() []bool {
+			var success []bool
+			for _, ack := range acks(t, n.transport, "10.2.2.0/24") {
+				success = append(success, ack.GetSuccess())
+			}
+			return success
+		}
+
+		// failed retries are not acknowledged
+		deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 1))
+		eventually(t, "failure ack", func() bool {
+			return len(success()) > 0
+		})
+		time.Sleep(200 * time.Millisecond)
+		if got := success(); !slices.Equal(got, []bool{false}) {
+			t.Fatalf("acks success = %v for a failing route, want [false]", got)
+		}
+
+		// the redelivered version is applied again
+		deliverRoute(t, n.transport, route(srv6_endpoint, "10.2.2.0/24", remote.Route_ADD, 1))
+		eventually(t, "second failure ack", func() bool {
+			return len(success()) == 2
+		})
+
+		// the first successful retry is acknowledged
+		n.dp.SetErr("RouteReplace", nil)
+		eventually(t, "success ack", func() bool {
+			return slices.Equal(success(), []bool{false, false, true})
+		})
+		time.Sleep(100 * time.Millisecond)
+		if got := versions(n.transport, "10.2.2.0/24"); !slices.Equal(got, []uint64{1, 1, 1}) {
+			t.Errorf("acks = %v, want [1 1 1]", got)
+		}
+	})
+}
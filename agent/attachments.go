@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"log"
+	"net"
+
+	"github.com/datum-cloud/galactic-agent/api/remote"
+	"github.com/datum-cloud/galactic-agent/srv6"
+	"github.com/datum-cloud/galactic-common/util"
+)
+
+// attach records a local attachment and, if VPCTopic is set, subscribes to
+// the topic of its VPC when it is the first one. Subscription errors are
+// logged, the transport retries on reconnect. It reports whether the
+// attachment is new.
+func (a *Agent) attach(srv6_endpoint string) bool {
+	vpc, _, err := util.DecodeSRv6Endpoint(net.ParseIP(srv6_endpoint))
+	if err != nil {
+		log.Printf("Attach failed: %v", err)
+		return false
+	}
+	a.subscribeMu.Lock()
+	defer a.subscribeMu.Unlock()
+	a.vpcsMu.Lock()
+	if a.vpcs == nil {
+		a.vpcs = make(map[string]map[string]struct{})
+	}
+	attachments, ok := a.vpcs[vpc]
+	if !ok {
+		attachments = make(map[string]struct{})
+		a.vpcs[vpc] = attachments
+	}
+	_, attached := attachments[srv6_endpoint]
+	attachments[srv6_endpoint] = struct{}{}
+	a.vpcsMu.Unlock()
+	if ok || a.config.VPCTopic == "" {
+		return !attached
+	}
+	topic := remote.ExpandTopic(a.config.VPCTopic, a.config.NodeID, vpc)
+	log.Printf("SUBSCRIBE: vpc='%s', topic='%s'", vpc, topic)
+	if err := a.transport.(remote.Subscriber).Subscribe(topic); err != nil {
+		log.Printf("Subscribe failed: %v", err)
+	}
+	return true
+}
+
+// detach removes a local attachment and, if VPCTopic is set, unsubscribes
+// from the topic of its VPC when it was the last one.
+func (a *Agent) detach(srv6_endpoint string) {
+	vpc, _, err := util.DecodeSRv6Endpoint(net.ParseIP(srv6_endpoint))
+	if err != nil {
+		log.Printf("Detach failed: %v", err)
+		return
+	}
+	a.subscribeMu.Lock()
+	defer a.subscribeMu.Unlock()
+	a.vpcsMu.Lock()
+	attachments, ok := a.vpcs[vpc]
+	delete(attachments, srv6_endpoint)
+	last := ok && len(attachments) == 0
+	if last {
+		delete(a.vpcs, vpc)
+	}
+	a.vpcsMu.Unlock()
+	if !last || a.config.VPCTopic == "" {
+		return
+	}
+	topic := remote.ExpandTopic(a.config.VPCTopic, a.config.NodeID, vpc)
+	log.Printf("UNSUBSCRIBE: vpc='%s', topic='%s'", vpc, topic)
+	if err := a.transport.(remote.Subscriber).Unsubscribe(topic); err != nil {
+		log.Printf("Unsubscribe failed: %v", err)
+	}
+}
+
+// foreign returns why a route received from the controller does not belong
+// to this node, or "" if its endpoint is a local attachment. Endpoints that
+// are not IPs are left to spec.Validate.
+func (a *Agent) foreign(spec srv6.EgressSpec) string {
+	ip := net.ParseIP(spec.Src)
+	if ip == nil {
+		return ""
+	}
+	// validated in New
+	_, srv6Net, _ := net.ParseCIDR(a.config.SRv6Net)
+	if !srv6Net.Contains(ip) {
+		return "outside_srv6_net"
+	}
+	vpc, _, err := util.DecodeSRv6Endpoint(ip)
+	if err != nil {
+		return ""
+	}
+	a.vpcsMu.Lock()
+	defer a.vpcsMu.Unlock()
+	if _, ok := a.vpcs[vpc][ip.String()]; !ok {
+		return "unknown_attachment"
+	}
+	return ""
+}
@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datum-cloud/galactic-agent/srv6"
+)
+
+// checkpointInterval bounds how often the checkpoint is saved, so that a
+// burst of route updates is written once.
+const checkpointInterval = time.Second
+
+// checkpoint is the set of egress routes last accepted from the controller.
+// It is restored at startup so that egress works before the controller is
+// reachable again.
+type checkpoint struct {
+	Version uint64            `json:"version"`
+	Updated time.Time         `json:"updated"`
+	Routes  []srv6.EgressSpec `json:"routes"`
+	// Versions holds the last applied controller version by route key,
+	// including routes deleted since the last snapshot.
+	Versions map[string]uint64 `json:"versions,omitempty"`
+}
+
+// routeKey identifies a route by (srv6_endpoint, network). Addresses are
+// normalized so that keys of controller messages match those of installed
+// routes.
+func routeKey(spec srv6.EgressSpec) string {
+	spec = normalize(spec)
+	return spec.Src + "/" + spec.Prefix
+}
+
+// normalize returns spec with its addresses in canonical form.
+func normalize(spec srv6.EgressSpec) srv6.EgressSpec {
+	if ip := net.ParseIP(spec.Src); ip != nil {
+		spec.Src = ip.String()
+	}
+	if ip, n, err := net.ParseCIDR(spec.Prefix); err == nil {
+		spec.Prefix = (&net.IPNet{IP: ip, Mask: n.Mask}).String()
+	}
+	return spec
+}
+
+func (a *Agent) initRoutes() {
+	if a.routes == nil {
+		a.routes = make(map[string]srv6.EgressSpec)
+		a.versions = make(map[string]uint64)
+		a.failed = make(map[string]struct{})
+		a.changed = make(map[string]uint64)
+	}
+}
+
+// appliedVersion returns the last applied controller version of the route
+// with key, 0 if none, and whether applying it failed.
+func (a *Agent) appliedVersion(key string) (uint64, bool) {
+	a.routesMu.Lock()
+	defer a.routesMu.Unlock()
+	_, failed := a.failed[key]
+	return a.versions[key], failed
+}
+
+// settle records the outcome of the last change of the route with key and
+// returns its version.
+func (a *Agent) settle(key string, err error) uint64 {
+	a.routesMu.Lock()
+	defer a.routesMu.Unlock()
+	a.initRoutes()
+	if err != nil {
+		a.failed[key] = struct{}{}
+	} else {
+		delete(a.failed, key)
+	}
+	return a.versions[key]
+}
+
+// updateRoutes applies update to the accepted routes and their versions and
+// schedules a checkpoint save.
+func (a *Agent) updateRoutes(update func(routes map[string]srv6.EgressSpec, versions map[string]uint64)) {
+	a.routesMu.Lock()
+	defer a.routesMu.Unlock()
+	a.initRoutes()
+	update(a.routes, a.versions)
+	a.routesVersion++
+	select {
+	case a.checkpointDirty <- struct{}{}:
+	default:
+	}
+}
+
+// flushRoutes forgets the routes and versions of the attachment with the
+// SRv6 endpoint srv6_endpoint, so that they are applied again if it is
+// registered anew.
+func (a *Agent) flushRoutes(srv6_endpoint string) {
+	src := normalize(srv6.EgressSpec{Src: srv6_endpoint}).Src
+	a.updateRoutes(func(routes map[string]srv6.EgressSpec, versions map[string]uint64) {
+		for key, spec := range routes {
+			if normalize(spec).Src == src {
+				delete(routes, key)
+			}
+		}
+		for key := range versions {
+			if strings.HasPrefix(key, src+"/") {
+				delete(versions, key)
+				delete(a.failed, key)
+				delete(a.changed, key)
+			}
+		}
+	})
+}
+
+// expireRoute forgets a route that the reconciler dropped after it stayed
+// pending, unless it was replaced meanwhile. Its version is kept.
+func (a *Agent) expireRoute(e srv6.EgressEvent) {
+	srv6_endpoint, err := a.endpoint(e.VPC, e.VPCAttachment)
+	if err != nil {
+		log.Printf("Expire failed: %v", err)
+		return
+	}
+	key := routeKey(srv6.EgressSpec{Prefix: e.Prefix.String(), Src: srv6_endpoint})
+	a.updateRoutes(func(routes map[string]srv6.EgressSpec, _ map[string]uint64) {
+		spec, ok := routes[key]
+		if ok && slices.EqualFunc(spec.Segments, e.Segments, func(segment string, ip net.IP) bool {
+			return ip.Equal(net.ParseIP(segment))
+		}) {
+			delete(routes, key)
+		}
+	})
+}
+
+// runCheckpoint saves the checkpoint after the routes changed, at most once
+// per checkpointInterval, and a last time when ctx is done.
+func (a *Agent) runCheckpoint(ctx context.Context) error {
+	save := func() {
+		if err := a.saveCheckpoint(); err != nil {
+			log.Printf("Checkpoint save failed: %v", err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			select {
+			case <-a.checkpointDirty:
+				save()
+			default:
+			}
+			return nil
+		case <-a.checkpointDirty:
+		}
+		save()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(checkpointInterval):
+		}
+	}
+}
+
+// saveCheckpoint copies the routes under routesMu and writes them without it.
+func (a *Agent) saveCheckpoint() error {
+	path := a.config.CheckpointPath
+	if path == "" {
+		return nil
+	}
+	a.routesMu.Lock()
+	cp := checkpoint{
+		Version:  a.routesVersion,
+		Updated:  time.Now().UTC(),
+		Routes:   make([]srv6.EgressSpec, 0, len(a.routes)),
+		Versions: maps.Clone(a.versions),
+	}
+	for _, spec := range a.routes {
+		cp.Routes = append(cp.Routes, spec)
+	}
+	a.routesMu.Unlock()
+
+	sort.Slice(cp.Routes, func(i, j int) bool {
+		return routeKey(cp.Routes[i]) < routeKey(cp.Routes[j])
+	})
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restoreCheckpoint installs the egress routes saved by a previous run. They
+// are replaced by the controller's snapshot once it arrives, which is also
+// waited for if the checkpoint is unreadable.
+func (a *Agent) restoreCheckpoint() error {
+	path := a.config.CheckpointPath
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		log.Printf("Checkpoint '%s' ignored: %v", path, err)
+		return nil
+	}
+
+	a.routesMu.Lock()
+	a.routes = make(map[string]srv6.EgressSpec, len(cp.Routes))
+	for _, spec := range cp.Routes {
+		a.routes[routeKey(spec)] = spec
+	}
+	a.versions = cp.Versions
+	if a.versions == nil {
+		a.versions = make(map[string]uint64)
+	}
+	a.failed = make(map[string]struct{})
+	a.changed = make(map[string]uint64)
+	a.routesVersion = cp.Version
+	a.routesMu.Unlock()
+
+	log.Printf("CHECKPOINT: routes=%d, version=%d, updated='%s'", len(cp.Routes), cp.Version, cp.Updated.Format(time.RFC3339))
+	if err := a.reconciler.SetEgress(cp.Routes); err != nil {
+		log.Printf("Checkpoint contains invalid routes: %v", err)
+	}
+	return nil
+}
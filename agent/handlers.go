@@ -0,0 +1,419 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/datum-cloud/galactic-agent/api/local"
+	"github.com/datum-cloud/galactic-agent/api/remote"
+	"github.com/datum-cloud/galactic-agent/metrics"
+	"github.com/datum-cloud/galactic-agent/srv6"
+	"github.com/datum-cloud/galactic-common/util"
+)
+
+func (a *Agent) publish(envelope *remote.Envelope) error {
+	payload, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	if err := a.remote.Send(payload); err != nil {
+		return err
+	}
+	metrics.MessagesSent.WithLabelValues(remote.KindName(envelope)).Inc()
+	return nil
+}
+
+func (a *Agent) endpoint(vpc, vpcAttachment string) (string, error) {
+	return util.EncodeSRv6Endpoint(a.config.SRv6Net, vpc, vpcAttachment)
+}
+
+func (a *Agent) register(vpc, vpcAttachment string, networks []string) error {
+	srv6_endpoint, err := a.endpoint(vpc, vpcAttachment)
+	if err != nil {
+		return err
+	}
+	if err := a.dispatcher.Do(context.Background(), srv6_endpoint, func() error {
+		return a.reconciler.RouteIngressAdd(srv6_endpoint)
+	}); err != nil {
+		return err
+	}
+	attached := a.attach(srv6_endpoint)
+	for _, n := range networks {
+		log.Printf("REGISTER: network='%s', srv6_endpoint='%s'", n, srv6_endpoint)
+		if err := a.publish(&remote.Envelope{
+			Kind: &remote.Envelope_Register{
+				Register: &remote.Register{
+					Network:      n,
+					Srv6Endpoint: srv6_endpoint,
+				},
+			},
+		}); err != nil {
+			// the registration is not stored, so a new attachment must not
+			// be left behind
+			if attached {
+				a.detach(srv6_endpoint)
+				if err := a.dispatcher.Do(context.Background(), srv6_endpoint, func() error {
+					return a.reconciler.RouteIngressDel(srv6_endpoint)
+				}); err != nil {
+					log.Printf("Register rollback failed: %v", err)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Agent) deregister(vpc, vpcAttachment string, networks []string) error {
+	srv6_endpoint, err := a.endpoint(vpc, vpcAttachment)
+	if err != nil {
+		return err
+	}
+	// the attachment stays if only some of its networks are deregistered
+	if len(a.local.Remaining(vpc, vpcAttachment, networks)) == 0 {
+		if err := a.dispatcher.Do(context.Background(), srv6_endpoint, func() error {
+			return a.reconciler.RouteIngressDel(srv6_endpoint)
+		}); err != nil {
+			return err
+		}
+		a.detach(srv6_endpoint)
+		// later updates of its routes, deletes included, are dropped as
+		// foreign, so its egress routes are removed here
+		if err := a.dispatcher.DoAll(context.Background(), func() error {
+			a.flushRoutes(srv6_endpoint)
+			return a.reconciler.RouteEgressFlush(srv6_endpoint)
+		}); err != nil {
+			return err
+		}
+	}
+	for _, n := range networks {
+		log.Printf("DEREGISTER: network='%s', srv6_endpoint='%s'", n, srv6_endpoint)
+		if err := a.publish(&remote.Envelope{
+			Kind: &remote.Envelope_Deregister{
+				Deregister: &remote.Deregister{
+					Network:      n,
+					Srv6Endpoint: srv6_endpoint,
+				},
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore reinstalls the ingress routes of the registrations saved before a
+// restart. They are announced to the controller again on connect.
+func (a *Agent) restore() error {
+	registrations, err := a.local.Restore()
+	if err != nil {
+		return err
+	}
+	for _, reg := range registrations {
+		srv6_endpoint, err := a.endpoint(reg.VPC, reg.VPCAttachment)
+		if err != nil {
+			return err
+		}
+		log.Printf("RESTORE: vpc='%s', vpcattachment='%s', networks='%s', srv6_endpoint='%s'", reg.VPC, reg.VPCAttachment, reg.Networks, srv6_endpoint)
+		if err := a.reconciler.RouteIngressAdd(srv6_endpoint); err != nil {
+			return err
+		}
+		a.attach(srv6_endpoint)
+	}
+	return nil
+}
+
+func (a *Agent) describe(vpc, vpcAttachment string) (*local.Attachment, error) {
+	srv6_endpoint, err := a.endpoint(vpc, vpcAttachment)
+	if err != nil {
+		return nil, err
+	}
+	vrfTable, routes, err := a.reconciler.Egress(vpc, vpcAttachment)
+	if err != nil {
+		return nil, err
+	}
+	attachment := &local.Attachment{
+		Srv6Endpoint: srv6_endpoint,
+		VrfTable:     vrfTable,
+	}
+	for _, route := range routes {
+		segments := make([]string, 0, len(route.Segments))
+		for _, segment := range route.Segments {
+			segments = append(segments, segment.String())
+		}
+		attachment.Routes = append(attachment.Routes, &local.EgressRoute{
+			Network:      route.Prefix.String(),
+			Srv6Segments: segments,
+		})
+	}
+	return attachment, nil
+}
+
+func (a *Agent) egressEvent(e srv6.EgressEvent) {
+	event := &local.RouteEvent{
+		Vpc:           e.VPC,
+		Vpcattachment: e.VPCAttachment,
+		Network:       e.Prefix.String(),
+		Success:       e.Err == nil,
+	}
+	for _, segment := range e.Segments {
+		event.Srv6Segments = append(event.Srv6Segments, segment.String())
+	}
+	if e.Delete {
+		event.Action = local.RouteEvent_DELETE
+	}
+	if e.Err != nil {
+		event.Error = e.Err.Error()
+	}
+	a.local.Publish(event)
+	if errors.Is(e.Err, srv6.ErrPendingExpired) {
+		a.expireRoute(e)
+	}
+
+	// retries and drift repairs are not acknowledged again, except for the
+	// first success after a failure
+	if !e.Requested {
+		return
+	}
+	srv6_endpoint, err := a.endpoint(e.VPC, e.VPCAttachment)
+	if err != nil {
+		log.Printf("Ack failed: %v", err)
+		return
+	}
+	network := e.Prefix.String()
+	status := remote.Route_ADD
+	if e.Delete {
+		status = remote.Route_DELETE
+	}
+	version := a.settle(routeKey(srv6.EgressSpec{Prefix: network, Src: srv6_endpoint}), e.Err)
+	a.ack(network, srv6_endpoint, status, version, e.Err)
+}
+
+// ack reports the result of applying a route to the controller.
+func (a *Agent) ack(network, srv6_endpoint string, status remote.Route_Status, version uint64, applyErr error) {
+	ack := &remote.Ack{
+		Network:      network,
+		Srv6Endpoint: srv6_endpoint,
+		Status:       status,
+		Version:      version,
+		Success:      applyErr == nil,
+	}
+	if applyErr != nil {
+		ack.Error = applyErr.Error()
+	}
+	log.Printf("ACK: status='%s', network='%s', srv6_endpoint='%s', version=%d, success=%t", status, network, srv6_endpoint, version, ack.Success)
+	if err := a.publish(&remote.Envelope{
+		Kind: &remote.Envelope_Ack{
+			Ack: ack,
+		},
+	}); err != nil {
+		log.Printf("Ack failed: %v", err)
+	}
+}
+
+func (a *Agent) presence(status remote.Presence_Status) *remote.Envelope {
+	return &remote.Envelope{
+		Kind: &remote.Envelope_Presence{
+			Presence: &remote.Presence{
+				NodeId:  a.config.NodeID,
+				Srv6Net: a.config.SRv6Net,
+				Version: a.config.Version,
+				Status:  status,
+			},
+		},
+	}
+}
+
+// connect announces the node, re-announces every registration and asks the
+// controller for a snapshot of the routes of the registered endpoints.
+func (a *Agent) connect() error {
+	log.Printf("PRESENCE: node_id='%s', srv6_net='%s', version='%s'", a.config.NodeID, a.config.SRv6Net, a.config.Version)
+	if err := a.publish(a.presence(remote.Presence_ONLINE)); err != nil {
+		return err
+	}
+	return a.announce()
+}
+
+// announce publishes the local registrations followed by a SyncRequest for
+// their endpoints.
+func (a *Agent) announce() error {
+	syncRequest := &remote.SyncRequest{}
+	for _, reg := range a.local.Registrations() {
+		srv6_endpoint, err := a.endpoint(reg.VPC, reg.VPCAttachment)
+		if err != nil {
+			return err
+		}
+		for _, n := range reg.Networks {
+			if err := a.publish(&remote.Envelope{
+				Kind: &remote.Envelope_Register{
+					Register: &remote.Register{
+						Network:      n,
+						Srv6Endpoint: srv6_endpoint,
+					},
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		syncRequest.Srv6Endpoints = append(syncRequest.Srv6Endpoints, srv6_endpoint)
+	}
+	a.routesMu.Lock()
+	a.generation++
+	syncRequest.Generation = a.generation
+	a.routesMu.Unlock()
+	log.Printf("SYNC REQUEST: srv6_endpoints='%s', generation=%d", syncRequest.Srv6Endpoints, syncRequest.Generation)
+	return a.publish(&remote.Envelope{
+		Kind: &remote.Envelope_SyncRequest{
+			SyncRequest: syncRequest,
+		},
+	})
+}
+
+func (a *Agent) receive(payload []byte) error {
+	envelope := &remote.Envelope{}
+	if err := proto.Unmarshal(payload, envelope); err != nil {
+		return err
+	}
+	metrics.MessagesReceived.WithLabelValues(remote.KindName(envelope)).Inc()
+	switch kind := envelope.Kind.(type) {
+	case *remote.Envelope_Route:
+		log.Printf("ROUTE: status='%s', network='%s', srv6_endpoint='%s', srv6_segments='%s', version=%d", kind.Route.Status, kind.Route.Network, kind.Route.Srv6Endpoint, kind.Route.Srv6Segments, kind.Route.Version)
+		spec := srv6.EgressSpec{
+			Prefix:   kind.Route.Network,
+			Src:      kind.Route.Srv6Endpoint,
+			Segments: kind.Route.Srv6Segments,
+		}
+		key, version := routeKey(spec), kind.Route.Version
+		return a.dispatcher.Do(context.Background(), key, func() error {
+			if reason := a.foreign(spec); reason != "" {
+				a.dropped(reason, spec, version)
+				return nil
+			}
+			// a redelivered version that failed is applied again
+			if applied, failed := a.appliedVersion(key); version != 0 && version <= applied && !(failed && version == applied) {
+				reason := "out_of_order"
+				if version == applied {
+					reason = "duplicate"
+				}
+				log.Printf("ROUTE DROPPED: reason='%s', network='%s', srv6_endpoint='%s', version=%d, applied=%d", reason, spec.Prefix, spec.Src, version, applied)
+				metrics.RoutesDropped.WithLabelValues(reason).Inc()
+				return nil
+			}
+			if err := spec.Validate(); err != nil {
+				a.ack(spec.Prefix, spec.Src, kind.Route.Status, version, err)
+				return err
+			}
+			// recorded first so that the reconciler acknowledges this version
+			a.updateRoutes(func(routes map[string]srv6.EgressSpec, versions map[string]uint64) {
+				if kind.Route.Status == remote.Route_DELETE {
+					delete(routes, key)
+				} else {
+					routes[key] = spec
+				}
+				if version != 0 {
+					versions[key] = version
+				}
+				a.changed[key] = a.generation
+			})
+			if kind.Route.Status == remote.Route_DELETE {
+				return a.reconciler.RouteEgressDel(spec.Prefix, spec.Src, spec.Segments)
+			}
+			return a.reconciler.RouteEgressAdd(spec.Prefix, spec.Src, spec.Segments)
+		})
+	case *remote.Envelope_Resync:
+		if node := kind.Resync.NodeId; node != "" && node != a.config.NodeID {
+			return nil
+		}
+		log.Printf("RESYNC: node_id='%s'", kind.Resync.NodeId)
+		return a.announce()
+	case *remote.Envelope_Snapshot:
+		log.Printf("SNAPSHOT: routes=%d, generation=%d", len(kind.Snapshot.Routes), kind.Snapshot.Generation)
+		var routes []*remote.Route
+		for _, route := range kind.Snapshot.Routes {
+			spec := srv6.EgressSpec{
+				Prefix:   route.Network,
+				Src:      route.Srv6Endpoint,
+				Segments: route.Srv6Segments,
+			}
+			if reason := a.foreign(spec); reason != "" {
+				a.dropped(reason, spec, route.Version)
+				continue
+			}
+			routes = append(routes, route)
+		}
+		return a.dispatcher.DoAll(context.Background(), func() error {
+			var specs []srv6.EgressSpec
+			// the snapshot is authoritative except for routes already
+			// applied at a newer version or changed after the SyncRequest
+			// it answers was sent. The versions of other routes it does not
+			// list are forgotten.
+			a.updateRoutes(func(applied map[string]srv6.EgressSpec, versions map[string]uint64) {
+				generation := kind.Snapshot.Generation
+				if generation == 0 {
+					generation = a.generation
+				}
+				newer := func(key string) bool {
+					changed, ok := a.changed[key]
+					return ok && changed >= generation
+				}
+				current := maps.Clone(applied)
+				clear(applied)
+				listed := make(map[string]struct{}, len(routes))
+				for _, route := range routes {
+					spec := srv6.EgressSpec{
+						Prefix:   route.Network,
+						Src:      route.Srv6Endpoint,
+						Segments: route.Srv6Segments,
+					}
+					key := routeKey(spec)
+					listed[key] = struct{}{}
+					if route.Version != 0 && route.Version < versions[key] {
+						log.Printf("ROUTE DROPPED: reason='out_of_order', network='%s', srv6_endpoint='%s', version=%d, applied=%d", spec.Prefix, spec.Src, route.Version, versions[key])
+						metrics.RoutesDropped.WithLabelValues("out_of_order").Inc()
+						if spec, ok := current[key]; ok {
+							applied[key] = spec
+						}
+						continue
+					}
+					if route.Status == remote.Route_ADD {
+						applied[key] = spec
+					}
+					versions[key] = max(versions[key], route.Version)
+				}
+				for key, spec := range current {
+					if _, ok := listed[key]; !ok && newer(key) {
+						applied[key] = spec
+					}
+				}
+				for key := range versions {
+					if _, ok := listed[key]; !ok && !newer(key) {
+						delete(versions, key)
+						delete(a.failed, key)
+					}
+				}
+				for key := range a.changed {
+					if !newer(key) {
+						delete(a.changed, key)
+					}
+				}
+				for _, spec := range applied {
+					specs = append(specs, spec)
+				}
+			})
+			err := a.reconciler.SetEgress(specs)
+			a.resynced.Store(true)
+			return err
+		})
+	}
+	return nil
+}
+
+// dropped reports a route that does not belong to this node, see foreign.
+func (a *Agent) dropped(reason string, spec srv6.EgressSpec, version uint64) {
+	log.Printf("ROUTE DROPPED: reason='%s', network='%s', srv6_endpoint='%s', version=%d", reason, spec.Prefix, spec.Src, version)
+	metrics.RoutesDropped.WithLabelValues(reason).Inc()
+}
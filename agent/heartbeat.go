@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datum-cloud/galactic-agent/api/remote"
+	"github.com/datum-cloud/galactic-agent/srv6"
+)
+
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// digest hashes lines as described on remote.Heartbeat.
+func digest(lines []string) string {
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line + "\n")) //nolint:errcheck
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (a *Agent) heartbeat() (*remote.Heartbeat, error) {
+	var registrations []string
+	for _, reg := range a.local.Registrations() {
+		srv6_endpoint, err := a.endpoint(reg.VPC, reg.VPCAttachment)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range reg.Networks {
+			registrations = append(registrations, srv6_endpoint+" "+n)
+		}
+	}
+
+	// installed rather than received routes, so that routes failing to
+	// install make the controller resync
+	var routes []string
+	for _, route := range a.reconciler.AppliedEgress() {
+		srv6_endpoint, err := a.endpoint(route.VPC, route.VPCAttachment)
+		if err != nil {
+			return nil, err
+		}
+		spec := normalize(srv6.EgressSpec{Src: srv6_endpoint, Prefix: route.Prefix.String()})
+		segments := make([]string, 0, len(route.Segments))
+		for _, segment := range route.Segments {
+			segments = append(segments, segment.String())
+		}
+		routes = append(routes, spec.Src+" "+spec.Prefix+" "+strings.Join(segments, ","))
+	}
+
+	return &remote.Heartbeat{
+		NodeId:              a.config.NodeID,
+		Registrations:       uint32(len(registrations)),
+		RegistrationsDigest: digest(registrations),
+		EgressRoutes:        uint32(len(routes)),
+		EgressRoutesDigest:  digest(routes),
+	}, nil
+}
+
+// runHeartbeat publishes a heartbeat every interval while the transport is
+// connected. Heartbeats are not queued while disconnected, the controller
+// gets a fresh one after the resync on connect.
+func (a *Agent) runHeartbeat(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if !a.transport.Connected() {
+			continue
+		}
+		heartbeat, err := a.heartbeat()
+		if err != nil {
+			log.Printf("Heartbeat failed: %v", err)
+			continue
+		}
+		if err := a.publish(&remote.Envelope{
+			Kind: &remote.Envelope_Heartbeat{
+				Heartbeat: heartbeat,
+			},
+		}); err != nil {
+			log.Printf("Heartbeat failed: %v", err)
+		}
+	}
+}
@@ -5,32 +5,308 @@ import (
 	"log"
 	"net"
 	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/datum-cloud/galactic-agent/metrics"
 )
 
 type Local struct {
 	UnimplementedLocalServer
-	SocketPath        string
+	SocketPath string
+	SocketMode os.FileMode
+	// SocketUID and SocketGID set the owner of the socket file, -1 leaves
+	// it unchanged.
+	SocketUID int
+	SocketGID int
+	// Rules restrict which peers may use the API and for which VPCs. No
+	// rules allow every peer.
+	Rules             []Rule
 	RegisterHandler   func(string, string, []string) error
 	DeregisterHandler func(string, string, []string) error
+	// DescribeHandler fills in the dataplane details (endpoint, VRF table,
+	// installed routes) of a registered attachment.
+	DescribeHandler func(string, string) (*Attachment, error)
+	// StorePath, if set, persists registrations so that they can be
+	// restored after a restart.
+	StorePath string
+
+	serving       atomic.Bool
+	mu            sync.Mutex
+	registrations map[registration]Registration
+	watchers      map[chan *RouteEvent]string
+}
+
+// registration keys an attachment by its normalized ids, see
+// registrationKey.
+type registration struct {
+	vpc           string
+	vpcAttachment string
+}
+
+// registrationKey returns the key of an attachment, under which it is found
+// whether its ids are zero padded or not. The ids it was first registered
+// with are kept for reporting.
+func registrationKey(vpc, vpcAttachment string) registration {
+	return registration{normalizeID(vpc), normalizeID(vpcAttachment)}
 }
 
 func (l *Local) Register(ctx context.Context, req *RegisterRequest) (*RegisterReply, error) {
+	if err := l.authorize(ctx, req.GetVpc()); err != nil {
+		return nil, err
+	}
 	if err := l.RegisterHandler(req.GetVpc(), req.GetVpcattachment(), req.GetNetworks()); err != nil {
 		return nil, err
 	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.registrations == nil {
+		l.registrations = make(map[registration]Registration)
+	}
+	key := registrationKey(req.GetVpc(), req.GetVpcattachment())
+	reg, ok := l.registrations[key]
+	if !ok {
+		reg = Registration{VPC: req.GetVpc(), VPCAttachment: req.GetVpcattachment()}
+	}
+	for _, n := range req.GetNetworks() {
+		if !slices.Contains(reg.Networks, n) {
+			reg.Networks = append(reg.Networks, n)
+		}
+	}
+	l.registrations[key] = reg
+	if err := l.save(); err != nil {
+		return nil, status.Errorf(codes.Internal, "persist registrations: %v", err)
+	}
 	return &RegisterReply{Confirmed: true}, nil
 }
 
 func (l *Local) Deregister(ctx context.Context, req *DeregisterRequest) (*DeregisterReply, error) {
+	if err := l.authorize(ctx, req.GetVpc()); err != nil {
+		return nil, err
+	}
 	if err := l.DeregisterHandler(req.GetVpc(), req.GetVpcattachment(), req.GetNetworks()); err != nil {
 		return nil, err
 	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := registrationKey(req.GetVpc(), req.GetVpcattachment())
+	reg := l.registrations[key]
+	if reg.Networks = remaining(reg.Networks, req.GetNetworks()); len(reg.Networks) > 0 {
+		l.registrations[key] = reg
+	} else {
+		delete(l.registrations, key)
+	}
+	if err := l.save(); err != nil {
+		return nil, status.Errorf(codes.Internal, "persist registrations: %v", err)
+	}
 	return &DeregisterReply{Confirmed: true}, nil
 }
 
+// remaining returns the networks left after deregistering removed, none if
+// removed is empty.
+func remaining(networks, removed []string) []string {
+	if len(removed) == 0 {
+		return nil
+	}
+	return slices.DeleteFunc(slices.Clone(networks), func(n string) bool {
+		return slices.Contains(removed, n)
+	})
+}
+
+// Remaining returns the networks of an attachment that stay registered once
+// removed are deregistered, none if removed is empty.
+func (l *Local) Remaining(vpc, vpcAttachment string, removed []string) []string {
+	return remaining(l.networks(registrationKey(vpc, vpcAttachment)), removed)
+}
+
+func (l *Local) ListAttachments(ctx context.Context, req *ListAttachmentsRequest) (*ListAttachmentsReply, error) {
+	registrations := l.Registrations()
+	sort.Slice(registrations, func(i, j int) bool {
+		if registrations[i].VPC != registrations[j].VPC {
+			return registrations[i].VPC < registrations[j].VPC
+		}
+		return registrations[i].VPCAttachment < registrations[j].VPCAttachment
+	})
+
+	reply := &ListAttachmentsReply{}
+	for _, reg := range registrations {
+		if l.authorize(ctx, reg.VPC) != nil {
+			continue
+		}
+		attachment, err := l.describe(registrationKey(reg.VPC, reg.VPCAttachment))
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			log.Printf("ListAttachments: describe vpc='%s', vpcattachment='%s' failed: %v", reg.VPC, reg.VPCAttachment, err)
+			attachment = &Attachment{Vpc: reg.VPC, Vpcattachment: reg.VPCAttachment, Networks: reg.Networks}
+		}
+		reply.Attachments = append(reply.Attachments, attachment)
+	}
+	return reply, nil
+}
+
+func (l *Local) DescribeAttachment(ctx context.Context, req *DescribeAttachmentRequest) (*DescribeAttachmentReply, error) {
+	if err := l.authorize(ctx, req.GetVpc()); err != nil {
+		return nil, err
+	}
+	attachment, err := l.describe(registrationKey(req.GetVpc(), req.GetVpcattachment()))
+	if err != nil {
+		return nil, err
+	}
+	return &DescribeAttachmentReply{Attachment: attachment}, nil
+}
+
+func (l *Local) Watch(req *WatchRequest, stream grpc.ServerStreamingServer[RouteEvent]) error {
+	if err := l.authorize(stream.Context(), req.GetVpc()); err != nil {
+		return err
+	}
+	events := make(chan *RouteEvent, 64)
+	l.mu.Lock()
+	if l.watchers == nil {
+		l.watchers = make(map[chan *RouteEvent]string)
+	}
+	l.watchers[events] = normalizeID(req.GetVpc())
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.watchers, events)
+		l.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Publish delivers a route event to all watchers of its VPC. Events are
+// dropped for watchers that do not keep up.
+func (l *Local) Publish(event *RouteEvent) {
+	vpc := normalizeID(event.GetVpc())
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for events, filter := range l.watchers {
+		if filter != "" && filter != vpc {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+			log.Printf("Watch: dropped event for slow watcher: vpc='%s', network='%s'", event.GetVpc(), event.GetNetwork())
+		}
+	}
+}
+
+// normalizeID strips the zero padding of a hex encoded id so that "4d2"
+// and "0000000004d2" match.
+func normalizeID(id string) string {
+	if id == "" {
+		return ""
+	}
+	id = strings.TrimLeft(strings.ToLower(id), "0")
+	if id == "" {
+		return "0"
+	}
+	return id
+}
+
+type Registration struct {
+	VPC           string   `json:"vpc"`
+	VPCAttachment string   `json:"vpcattachment"`
+	Networks      []string `json:"networks"`
+}
+
+func (l *Local) Registrations() []Registration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.registrationsLocked()
+}
+
+func (l *Local) registrationsLocked() []Registration {
+	registrations := make([]Registration, 0, len(l.registrations))
+	for _, reg := range l.registrations {
+		reg.Networks = slices.Clone(reg.Networks)
+		registrations = append(registrations, reg)
+	}
+	return registrations
+}
+
+func (l *Local) networks(key registration) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.registrations[key].Networks)
+}
+
+func (l *Local) describe(key registration) (*Attachment, error) {
+	l.mu.Lock()
+	reg, ok := l.registrations[key]
+	reg.Networks = slices.Clone(reg.Networks)
+	l.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "attachment not registered: vpc='%s', vpcattachment='%s'", key.vpc, key.vpcAttachment)
+	}
+
+	attachment, err := l.DescribeHandler(reg.VPC, reg.VPCAttachment)
+	if err != nil {
+		return nil, err
+	}
+	attachment.Vpc = reg.VPC
+	attachment.Vpcattachment = reg.VPCAttachment
+	attachment.Networks = reg.Networks
+	return attachment, nil
+}
+
+func (l *Local) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	var resp any
+	err := l.checkPeer(ctx, info.FullMethod)
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	method := path.Base(info.FullMethod)
+	metrics.GRPCRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	metrics.GRPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+func (l *Local) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := l.checkPeer(ss.Context(), info.FullMethod)
+	if err == nil {
+		err = handler(srv, ss)
+	}
+	metrics.GRPCRequests.WithLabelValues(path.Base(info.FullMethod), status.Code(err).String()).Inc()
+	return err
+}
+
+// checkPeer rejects callers not matching any rule.
+func (l *Local) checkPeer(ctx context.Context, method string) error {
+	if len(l.Rules) == 0 {
+		return nil
+	}
+	if _, err := l.peerRules(ctx); err != nil {
+		log.Printf("gRPC %s denied: %v", method, err)
+		return err
+	}
+	return nil
+}
+
 func (l *Local) Serve(ctx context.Context) error {
 	// unix socket should be unlinked if it exists first
 	// see: https://github.com/golang/go/issues/70985
@@ -44,7 +320,25 @@ func (l *Local) Serve(ctx context.Context) error {
 	}
 	defer listener.Close() //nolint:errcheck
 
-	s := grpc.NewServer()
+	if l.SocketMode != 0 {
+		if err := os.Chmod(l.SocketPath, l.SocketMode); err != nil {
+			return err
+		}
+	}
+	if l.SocketUID >= 0 || l.SocketGID >= 0 {
+		if err := os.Chown(l.SocketPath, l.SocketUID, l.SocketGID); err != nil {
+			return err
+		}
+	}
+	if len(l.Rules) == 0 {
+		log.Printf("gRPC peer authorization disabled: no rules configured")
+	}
+
+	s := grpc.NewServer(
+		grpc.Creds(PeerCredentials{}),
+		grpc.UnaryInterceptor(l.unaryInterceptor),
+		grpc.StreamInterceptor(l.streamInterceptor),
+	)
 	RegisterLocalServer(s, l)
 
 	reflection.Register(s)
@@ -52,6 +346,8 @@ func (l *Local) Serve(ctx context.Context) error {
 	routineErr := make(chan error, 1)
 	go func() {
 		log.Printf("gRPC listening: unix://%s", l.SocketPath)
+		l.serving.Store(true)
+		defer l.serving.Store(false)
 		if err := s.Serve(listener); err != nil {
 			routineErr <- err
 			return
@@ -64,3 +360,7 @@ func (l *Local) Serve(ctx context.Context) error {
 	log.Println("gRPC stopped")
 	return <-routineErr
 }
+
+func (l *Local) Serving() bool {
+	return l.serving.Load()
+}
@@ -21,6 +21,52 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type RouteEvent_Action int32
+
+const (
+	RouteEvent_ADD    RouteEvent_Action = 0
+	RouteEvent_DELETE RouteEvent_Action = 1
+)
+
+// Enum value maps for RouteEvent_Action.
+var (
+	RouteEvent_Action_name = map[int32]string{
+		0: "ADD",
+		1: "DELETE",
+	}
+	RouteEvent_Action_value = map[string]int32{
+		"ADD":    0,
+		"DELETE": 1,
+	}
+)
+
+func (x RouteEvent_Action) Enum() *RouteEvent_Action {
+	p := new(RouteEvent_Action)
+	*p = x
+	return p
+}
+
+func (x RouteEvent_Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (RouteEvent_Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_local_proto_enumTypes[0].Descriptor()
+}
+
+func (RouteEvent_Action) Type() protoreflect.EnumType {
+	return &file_local_proto_enumTypes[0]
+}
+
+func (x RouteEvent_Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use RouteEvent_Action.Descriptor instead.
+func (RouteEvent_Action) EnumDescriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{11, 0}
+}
+
 type RegisterRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Vpc           string                 `protobuf:"bytes,1,opt,name=vpc,proto3" json:"vpc,omitempty"`
@@ -229,6 +275,455 @@ func (x *DeregisterReply) GetConfirmed() bool {
 	return false
 }
 
+type EgressRoute struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Network       string                 `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	Srv6Segments  []string               `protobuf:"bytes,2,rep,name=srv6_segments,json=srv6Segments,proto3" json:"srv6_segments,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EgressRoute) Reset() {
+	*x = EgressRoute{}
+	mi := &file_local_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EgressRoute) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EgressRoute) ProtoMessage() {}
+
+func (x *EgressRoute) ProtoReflect() protoreflect.Message {
+	mi := &file_local_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EgressRoute.ProtoReflect.Descriptor instead.
+func (*EgressRoute) Descriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EgressRoute) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *EgressRoute) GetSrv6Segments() []string {
+	if x != nil {
+		return x.Srv6Segments
+	}
+	return nil
+}
+
+type Attachment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Vpc           string                 `protobuf:"bytes,1,opt,name=vpc,proto3" json:"vpc,omitempty"`
+	Vpcattachment string                 `protobuf:"bytes,2,opt,name=vpcattachment,proto3" json:"vpcattachment,omitempty"`
+	Networks      []string               `protobuf:"bytes,3,rep,name=networks,proto3" json:"networks,omitempty"`
+	Srv6Endpoint  string                 `protobuf:"bytes,4,opt,name=srv6_endpoint,json=srv6Endpoint,proto3" json:"srv6_endpoint,omitempty"`
+	VrfTable      uint32                 `protobuf:"varint,5,opt,name=vrf_table,json=vrfTable,proto3" json:"vrf_table,omitempty"`
+	Routes        []*EgressRoute         `protobuf:"bytes,6,rep,name=routes,proto3" json:"routes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Attachment) Reset() {
+	*x = Attachment{}
+	mi := &file_local_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Attachment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Attachment) ProtoMessage() {}
+
+func (x *Attachment) ProtoReflect() protoreflect.Message {
+	mi := &file_local_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Attachment.ProtoReflect.Descriptor instead.
+func (*Attachment) Descriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Attachment) GetVpc() string {
+	if x != nil {
+		return x.Vpc
+	}
+	return ""
+}
+
+func (x *Attachment) GetVpcattachment() string {
+	if x != nil {
+		return x.Vpcattachment
+	}
+	return ""
+}
+
+func (x *Attachment) GetNetworks() []string {
+	if x != nil {
+		return x.Networks
+	}
+	return nil
+}
+
+func (x *Attachment) GetSrv6Endpoint() string {
+	if x != nil {
+		return x.Srv6Endpoint
+	}
+	return ""
+}
+
+func (x *Attachment) GetVrfTable() uint32 {
+	if x != nil {
+		return x.VrfTable
+	}
+	return 0
+}
+
+func (x *Attachment) GetRoutes() []*EgressRoute {
+	if x != nil {
+		return x.Routes
+	}
+	return nil
+}
+
+type ListAttachmentsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAttachmentsRequest) Reset() {
+	*x = ListAttachmentsRequest{}
+	mi := &file_local_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAttachmentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAttachmentsRequest) ProtoMessage() {}
+
+func (x *ListAttachmentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_local_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAttachmentsRequest.ProtoReflect.Descriptor instead.
+func (*ListAttachmentsRequest) Descriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{6}
+}
+
+type ListAttachmentsReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Attachments   []*Attachment          `protobuf:"bytes,1,rep,name=attachments,proto3" json:"attachments,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAttachmentsReply) Reset() {
+	*x = ListAttachmentsReply{}
+	mi := &file_local_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAttachmentsReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAttachmentsReply) ProtoMessage() {}
+
+func (x *ListAttachmentsReply) ProtoReflect() protoreflect.Message {
+	mi := &file_local_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAttachmentsReply.ProtoReflect.Descriptor instead.
+func (*ListAttachmentsReply) Descriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListAttachmentsReply) GetAttachments() []*Attachment {
+	if x != nil {
+		return x.Attachments
+	}
+	return nil
+}
+
+type DescribeAttachmentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Vpc           string                 `protobuf:"bytes,1,opt,name=vpc,proto3" json:"vpc,omitempty"`
+	Vpcattachment string                 `protobuf:"bytes,2,opt,name=vpcattachment,proto3" json:"vpcattachment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DescribeAttachmentRequest) Reset() {
+	*x = DescribeAttachmentRequest{}
+	mi := &file_local_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DescribeAttachmentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DescribeAttachmentRequest) ProtoMessage() {}
+
+func (x *DescribeAttachmentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_local_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DescribeAttachmentRequest.ProtoReflect.Descriptor instead.
+func (*DescribeAttachmentRequest) Descriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DescribeAttachmentRequest) GetVpc() string {
+	if x != nil {
+		return x.Vpc
+	}
+	return ""
+}
+
+func (x *DescribeAttachmentRequest) GetVpcattachment() string {
+	if x != nil {
+		return x.Vpcattachment
+	}
+	return ""
+}
+
+type DescribeAttachmentReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Attachment    *Attachment            `protobuf:"bytes,1,opt,name=attachment,proto3" json:"attachment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DescribeAttachmentReply) Reset() {
+	*x = DescribeAttachmentReply{}
+	mi := &file_local_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DescribeAttachmentReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DescribeAttachmentReply) ProtoMessage() {}
+
+func (x *DescribeAttachmentReply) ProtoReflect() protoreflect.Message {
+	mi := &file_local_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DescribeAttachmentReply.ProtoReflect.Descriptor instead.
+func (*DescribeAttachmentReply) Descriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DescribeAttachmentReply) GetAttachment() *Attachment {
+	if x != nil {
+		return x.Attachment
+	}
+	return nil
+}
+
+type WatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// empty to watch all VPCs
+	Vpc           string `protobuf:"bytes,1,opt,name=vpc,proto3" json:"vpc,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_local_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_local_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *WatchRequest) GetVpc() string {
+	if x != nil {
+		return x.Vpc
+	}
+	return ""
+}
+
+type RouteEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Vpc           string                 `protobuf:"bytes,1,opt,name=vpc,proto3" json:"vpc,omitempty"`
+	Vpcattachment string                 `protobuf:"bytes,2,opt,name=vpcattachment,proto3" json:"vpcattachment,omitempty"`
+	Network       string                 `protobuf:"bytes,3,opt,name=network,proto3" json:"network,omitempty"`
+	Srv6Segments  []string               `protobuf:"bytes,4,rep,name=srv6_segments,json=srv6Segments,proto3" json:"srv6_segments,omitempty"`
+	Action        RouteEvent_Action      `protobuf:"varint,5,opt,name=action,proto3,enum=local.v1.RouteEvent_Action" json:"action,omitempty"`
+	Success       bool                   `protobuf:"varint,6,opt,name=success,proto3" json:"success,omitempty"`
+	Error         string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RouteEvent) Reset() {
+	*x = RouteEvent{}
+	mi := &file_local_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RouteEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RouteEvent) ProtoMessage() {}
+
+func (x *RouteEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_local_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RouteEvent.ProtoReflect.Descriptor instead.
+func (*RouteEvent) Descriptor() ([]byte, []int) {
+	return file_local_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *RouteEvent) GetVpc() string {
+	if x != nil {
+		return x.Vpc
+	}
+	return ""
+}
+
+func (x *RouteEvent) GetVpcattachment() string {
+	if x != nil {
+		return x.Vpcattachment
+	}
+	return ""
+}
+
+func (x *RouteEvent) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *RouteEvent) GetSrv6Segments() []string {
+	if x != nil {
+		return x.Srv6Segments
+	}
+	return nil
+}
+
+func (x *RouteEvent) GetAction() RouteEvent_Action {
+	if x != nil {
+		return x.Action
+	}
+	return RouteEvent_ADD
+}
+
+func (x *RouteEvent) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *RouteEvent) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 var File_local_proto protoreflect.FileDescriptor
 
 const file_local_proto_rawDesc = "" +
@@ -245,11 +740,50 @@ const file_local_proto_rawDesc = "" +
 	"\rvpcattachment\x18\x02 \x01(\tR\rvpcattachment\x12\x1a\n" +
 	"\bnetworks\x18\x03 \x03(\tR\bnetworks\"/\n" +
 	"\x0fDeregisterReply\x12\x1c\n" +
-	"\tconfirmed\x18\x01 \x01(\bR\tconfirmed2\x8d\x01\n" +
+	"\tconfirmed\x18\x01 \x01(\bR\tconfirmed\"L\n" +
+	"\vEgressRoute\x12\x18\n" +
+	"\anetwork\x18\x01 \x01(\tR\anetwork\x12#\n" +
+	"\rsrv6_segments\x18\x02 \x03(\tR\fsrv6Segments\"\xd1\x01\n" +
+	"\n" +
+	"Attachment\x12\x10\n" +
+	"\x03vpc\x18\x01 \x01(\tR\x03vpc\x12$\n" +
+	"\rvpcattachment\x18\x02 \x01(\tR\rvpcattachment\x12\x1a\n" +
+	"\bnetworks\x18\x03 \x03(\tR\bnetworks\x12#\n" +
+	"\rsrv6_endpoint\x18\x04 \x01(\tR\fsrv6Endpoint\x12\x1b\n" +
+	"\tvrf_table\x18\x05 \x01(\rR\bvrfTable\x12-\n" +
+	"\x06routes\x18\x06 \x03(\v2\x15.local.v1.EgressRouteR\x06routes\"\x18\n" +
+	"\x16ListAttachmentsRequest\"N\n" +
+	"\x14ListAttachmentsReply\x126\n" +
+	"\vattachments\x18\x01 \x03(\v2\x14.local.v1.AttachmentR\vattachments\"S\n" +
+	"\x19DescribeAttachmentRequest\x12\x10\n" +
+	"\x03vpc\x18\x01 \x01(\tR\x03vpc\x12$\n" +
+	"\rvpcattachment\x18\x02 \x01(\tR\rvpcattachment\"O\n" +
+	"\x17DescribeAttachmentReply\x124\n" +
+	"\n" +
+	"attachment\x18\x01 \x01(\v2\x14.local.v1.AttachmentR\n" +
+	"attachment\" \n" +
+	"\fWatchRequest\x12\x10\n" +
+	"\x03vpc\x18\x01 \x01(\tR\x03vpc\"\x87\x02\n" +
+	"\n" +
+	"RouteEvent\x12\x10\n" +
+	"\x03vpc\x18\x01 \x01(\tR\x03vpc\x12$\n" +
+	"\rvpcattachment\x18\x02 \x01(\tR\rvpcattachment\x12\x18\n" +
+	"\anetwork\x18\x03 \x01(\tR\anetwork\x12#\n" +
+	"\rsrv6_segments\x18\x04 \x03(\tR\fsrv6Segments\x123\n" +
+	"\x06action\x18\x05 \x01(\x0e2\x1b.local.v1.RouteEvent.ActionR\x06action\x12\x18\n" +
+	"\asuccess\x18\x06 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\"\x1d\n" +
+	"\x06Action\x12\a\n" +
+	"\x03ADD\x10\x00\x12\n" +
+	"\n" +
+	"\x06DELETE\x10\x012\xf9\x02\n" +
 	"\x05Local\x12>\n" +
 	"\bRegister\x12\x19.local.v1.RegisterRequest\x1a\x17.local.v1.RegisterReply\x12D\n" +
 	"\n" +
-	"Deregister\x12\x1b.local.v1.DeregisterRequest\x1a\x19.local.v1.DeregisterReplyB7Z5github.com/datum-cloud/galactic-agent/api/local;localb\x06proto3"
+	"Deregister\x12\x1b.local.v1.DeregisterRequest\x1a\x19.local.v1.DeregisterReply\x12S\n" +
+	"\x0fListAttachments\x12 .local.v1.ListAttachmentsRequest\x1a\x1e.local.v1.ListAttachmentsReply\x12\\\n" +
+	"\x12DescribeAttachment\x12#.local.v1.DescribeAttachmentRequest\x1a!.local.v1.DescribeAttachmentReply\x127\n" +
+	"\x05Watch\x12\x16.local.v1.WatchRequest\x1a\x14.local.v1.RouteEvent0\x01B7Z5github.com/datum-cloud/galactic-agent/api/local;localb\x06proto3"
 
 var (
 	file_local_proto_rawDescOnce sync.Once
@@ -263,23 +797,43 @@ func file_local_proto_rawDescGZIP() []byte {
 	return file_local_proto_rawDescData
 }
 
-var file_local_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_local_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_local_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
 var file_local_proto_goTypes = []any{
-	(*RegisterRequest)(nil),   // 0: local.v1.RegisterRequest
-	(*RegisterReply)(nil),     // 1: local.v1.RegisterReply
-	(*DeregisterRequest)(nil), // 2: local.v1.DeregisterRequest
-	(*DeregisterReply)(nil),   // 3: local.v1.DeregisterReply
+	(RouteEvent_Action)(0),            // 0: local.v1.RouteEvent.Action
+	(*RegisterRequest)(nil),           // 1: local.v1.RegisterRequest
+	(*RegisterReply)(nil),             // 2: local.v1.RegisterReply
+	(*DeregisterRequest)(nil),         // 3: local.v1.DeregisterRequest
+	(*DeregisterReply)(nil),           // 4: local.v1.DeregisterReply
+	(*EgressRoute)(nil),               // 5: local.v1.EgressRoute
+	(*Attachment)(nil),                // 6: local.v1.Attachment
+	(*ListAttachmentsRequest)(nil),    // 7: local.v1.ListAttachmentsRequest
+	(*ListAttachmentsReply)(nil),      // 8: local.v1.ListAttachmentsReply
+	(*DescribeAttachmentRequest)(nil), // 9: local.v1.DescribeAttachmentRequest
+	(*DescribeAttachmentReply)(nil),   // 10: local.v1.DescribeAttachmentReply
+	(*WatchRequest)(nil),              // 11: local.v1.WatchRequest
+	(*RouteEvent)(nil),                // 12: local.v1.RouteEvent
 }
 var file_local_proto_depIdxs = []int32{
-	0, // 0: local.v1.Local.Register:input_type -> local.v1.RegisterRequest
-	2, // 1: local.v1.Local.Deregister:input_type -> local.v1.DeregisterRequest
-	1, // 2: local.v1.Local.Register:output_type -> local.v1.RegisterReply
-	3, // 3: local.v1.Local.Deregister:output_type -> local.v1.DeregisterReply
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	5,  // 0: local.v1.Attachment.routes:type_name -> local.v1.EgressRoute
+	6,  // 1: local.v1.ListAttachmentsReply.attachments:type_name -> local.v1.Attachment
+	6,  // 2: local.v1.DescribeAttachmentReply.attachment:type_name -> local.v1.Attachment
+	0,  // 3: local.v1.RouteEvent.action:type_name -> local.v1.RouteEvent.Action
+	1,  // 4: local.v1.Local.Register:input_type -> local.v1.RegisterRequest
+	3,  // 5: local.v1.Local.Deregister:input_type -> local.v1.DeregisterRequest
+	7,  // 6: local.v1.Local.ListAttachments:input_type -> local.v1.ListAttachmentsRequest
+	9,  // 7: local.v1.Local.DescribeAttachment:input_type -> local.v1.DescribeAttachmentRequest
+	11, // 8: local.v1.Local.Watch:input_type -> local.v1.WatchRequest
+	2,  // 9: local.v1.Local.Register:output_type -> local.v1.RegisterReply
+	4,  // 10: local.v1.Local.Deregister:output_type -> local.v1.DeregisterReply
+	8,  // 11: local.v1.Local.ListAttachments:output_type -> local.v1.ListAttachmentsReply
+	10, // 12: local.v1.Local.DescribeAttachment:output_type -> local.v1.DescribeAttachmentReply
+	12, // 13: local.v1.Local.Watch:output_type -> local.v1.RouteEvent
+	9,  // [9:14] is the sub-list for method output_type
+	4,  // [4:9] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_local_proto_init() }
@@ -292,13 +846,14 @@ func file_local_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_local_proto_rawDesc), len(file_local_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   4,
+			NumEnums:      1,
+			NumMessages:   12,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_local_proto_goTypes,
 		DependencyIndexes: file_local_proto_depIdxs,
+		EnumInfos:         file_local_proto_enumTypes,
 		MessageInfos:      file_local_proto_msgTypes,
 	}.Build()
 	File_local_proto = out.File
@@ -19,8 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Local_Register_FullMethodName   = "/local.v1.Local/Register"
-	Local_Deregister_FullMethodName = "/local.v1.Local/Deregister"
+	Local_Register_FullMethodName           = "/local.v1.Local/Register"
+	Local_Deregister_FullMethodName         = "/local.v1.Local/Deregister"
+	Local_ListAttachments_FullMethodName    = "/local.v1.Local/ListAttachments"
+	Local_DescribeAttachment_FullMethodName = "/local.v1.Local/DescribeAttachment"
+	Local_Watch_FullMethodName              = "/local.v1.Local/Watch"
 )
 
 // LocalClient is the client API for Local service.
@@ -29,6 +32,9 @@ const (
 type LocalClient interface {
 	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterReply, error)
 	Deregister(ctx context.Context, in *DeregisterRequest, opts ...grpc.CallOption) (*DeregisterReply, error)
+	ListAttachments(ctx context.Context, in *ListAttachmentsRequest, opts ...grpc.CallOption) (*ListAttachmentsReply, error)
+	DescribeAttachment(ctx context.Context, in *DescribeAttachmentRequest, opts ...grpc.CallOption) (*DescribeAttachmentReply, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RouteEvent], error)
 }
 
 type localClient struct {
@@ -59,12 +65,54 @@ func (c *localClient) Deregister(ctx context.Context, in *DeregisterRequest, opt
 	return out, nil
 }
 
+func (c *localClient) ListAttachments(ctx context.Context, in *ListAttachmentsRequest, opts ...grpc.CallOption) (*ListAttachmentsReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAttachmentsReply)
+	err := c.cc.Invoke(ctx, Local_ListAttachments_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *localClient) DescribeAttachment(ctx context.Context, in *DescribeAttachmentRequest, opts ...grpc.CallOption) (*DescribeAttachmentReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DescribeAttachmentReply)
+	err := c.cc.Invoke(ctx, Local_DescribeAttachment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *localClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RouteEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Local_ServiceDesc.Streams[0], Local_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, RouteEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Local_WatchClient = grpc.ServerStreamingClient[RouteEvent]
+
 // LocalServer is the server API for Local service.
 // All implementations must embed UnimplementedLocalServer
 // for forward compatibility.
 type LocalServer interface {
 	Register(context.Context, *RegisterRequest) (*RegisterReply, error)
 	Deregister(context.Context, *DeregisterRequest) (*DeregisterReply, error)
+	ListAttachments(context.Context, *ListAttachmentsRequest) (*ListAttachmentsReply, error)
+	DescribeAttachment(context.Context, *DescribeAttachmentRequest) (*DescribeAttachmentReply, error)
+	Watch(*WatchRequest, grpc.ServerStreamingServer[RouteEvent]) error
 	mustEmbedUnimplementedLocalServer()
 }
 
@@ -81,6 +129,15 @@ func (UnimplementedLocalServer) Register(context.Context, *RegisterRequest) (*Re
 func (UnimplementedLocalServer) Deregister(context.Context, *DeregisterRequest) (*DeregisterReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Deregister not implemented")
 }
+func (UnimplementedLocalServer) ListAttachments(context.Context, *ListAttachmentsRequest) (*ListAttachmentsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAttachments not implemented")
+}
+func (UnimplementedLocalServer) DescribeAttachment(context.Context, *DescribeAttachmentRequest) (*DescribeAttachmentReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeAttachment not implemented")
+}
+func (UnimplementedLocalServer) Watch(*WatchRequest, grpc.ServerStreamingServer[RouteEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedLocalServer) mustEmbedUnimplementedLocalServer() {}
 func (UnimplementedLocalServer) testEmbeddedByValue()               {}
 
@@ -138,6 +195,53 @@ func _Local_Deregister_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Local_ListAttachments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAttachmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocalServer).ListAttachments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Local_ListAttachments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocalServer).ListAttachments(ctx, req.(*ListAttachmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Local_DescribeAttachment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeAttachmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocalServer).DescribeAttachment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Local_DescribeAttachment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocalServer).DescribeAttachment(ctx, req.(*DescribeAttachmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Local_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LocalServer).Watch(m, &grpc.GenericServerStream[WatchRequest, RouteEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Local_WatchServer = grpc.ServerStreamingServer[RouteEvent]
+
 // Local_ServiceDesc is the grpc.ServiceDesc for Local service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,7 +257,21 @@ var Local_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Deregister",
 			Handler:    _Local_Deregister_Handler,
 		},
+		{
+			MethodName: "ListAttachments",
+			Handler:    _Local_ListAttachments_Handler,
+		},
+		{
+			MethodName: "DescribeAttachment",
+			Handler:    _Local_DescribeAttachment_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Local_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "local.proto",
 }
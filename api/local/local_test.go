@@ -0,0 +1,237 @@
+package local_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/datum-cloud/galactic-agent/api/local"
+)
+
+func TestDeregisterNetworks(t *testing.T) {
+	client := serve(t, &local.Local{})
+	ctx := context.Background()
+	if _, err := client.Register(ctx, &local.RegisterRequest{
+		Vpc:           vpc,
+		Vpcattachment: vpcAttachment,
+		Networks:      []string{"10.1.1.0/24", "10.1.2.0/24"},
+	}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	networks := func() []string {
+		t.Helper()
+		reply, err := client.ListAttachments(ctx, &local.ListAttachmentsRequest{})
+		if err != nil {
+			t.Fatalf("ListAttachments() error = %v", err)
+		}
+		var networks []string
+		for _, attachment := range reply.GetAttachments() {
+			networks = append(networks, attachment.GetNetworks()...)
+		}
+		return networks
+	}
+
+	for _, tt := range []struct {
+		networks []string
+		want     []string
+	}{
+		{[]string{"10.1.1.0/24"}, []string{"10.1.2.0/24"}},
+		{[]string{"10.1.2.0/24"}, nil},
+	} {
+		if _, err := client.Deregister(ctx, &local.DeregisterRequest{
+			Vpc:           vpc,
+			Vpcattachment: vpcAttachment,
+			Networks:      tt.networks,
+		}); err != nil {
+			t.Fatalf("Deregister() error = %v", err)
+		}
+		if got := networks(); !slices.Equal(got, tt.want) {
+			t.Errorf("networks after deregistering %v = %v, want %v", tt.networks, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterPaddedIDs(t *testing.T) {
+	client := serve(t, &local.Local{})
+	ctx := context.Background()
+	// the same attachment with and without zero padding
+	for _, req := range []*local.RegisterRequest{
+		{Vpc: "4D2", Vpcattachment: "2a", Networks: []string{"10.1.1.0/24"}},
+		{Vpc: vpc, Vpcattachment: vpcAttachment, Networks: []string{"10.1.2.0/24"}},
+	} {
+		if _, err := client.Register(ctx, req); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+	}
+	reply, err := client.ListAttachments(ctx, &local.ListAttachmentsRequest{})
+	if err != nil {
+		t.Fatalf("ListAttachments() error = %v", err)
+	}
+	want := []string{"10.1.1.0/24", "10.1.2.0/24"}
+	if got := reply.GetAttachments(); len(got) != 1 || got[0].GetVpc() != "4D2" || !slices.Equal(got[0].GetNetworks(), want) {
+		t.Fatalf("ListAttachments() = %v, want one attachment of vpc 4D2 with %v", got, want)
+	}
+
+	if _, err := client.Deregister(ctx, &local.DeregisterRequest{
+		Vpc:           vpc,
+		Vpcattachment: vpcAttachment,
+		Networks:      want,
+	}); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	if reply, err = client.ListAttachments(ctx, &local.ListAttachmentsRequest{}); err != nil {
+		t.Fatalf("ListAttachments() error = %v", err)
+	}
+	if got := reply.GetAttachments(); len(got) != 0 {
+		t.Errorf("ListAttachments() after deregistering = %v, want none", got)
+	}
+}
+
+// ready is the network of the events published by await.
+const ready = "ready"
+
+// watch opens a Watch stream for vpc, empty for all VPCs.
+func watch(t *testing.T, client local.LocalClient, vpc string) grpc.ServerStreamingClient[local.RouteEvent] {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stream, err := client.Watch(ctx, &local.WatchRequest{Vpc: vpc}, grpc.WaitForReady(true))
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	return stream
+}
+
+// receive returns the events of stream.
+func receive(stream grpc.ServerStreamingClient[local.RouteEvent]) <-chan *local.RouteEvent {
+	events := make(chan *local.RouteEvent, 16)
+	go func() {
+		defer close(events)
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			events <- event
+		}
+	}()
+	return events
+}
+
+// await publishes events of vpc until every watcher received one, as the
+// stream is registered by the server only after Watch returned.
+func await(t *testing.T, l *local.Local, watchers ...<-chan *local.RouteEvent) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for _, events := range watchers {
+		for received := false; !received; {
+			l.Publish(&local.RouteEvent{Vpc: vpc, Network: ready})
+			select {
+			case event := <-events:
+				received = event.GetNetwork() == ready
+			case <-time.After(10 * time.Millisecond):
+			case <-deadline:
+				t.Fatal("timed out waiting for watchers")
+			}
+		}
+	}
+}
+
+// next returns the network of the next event of events, skipping those
+// published by await.
+func next(t *testing.T, events <-chan *local.RouteEvent) string {
+	t.Helper()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("watch stream closed")
+			}
+			if event.GetNetwork() != ready {
+				return event.GetNetwork()
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	l := &local.Local{}
+	client := serve(t, l)
+	padded := receive(watch(t, client, vpc))
+	unpadded := receive(watch(t, client, "4D2"))
+	all := receive(watch(t, client, ""))
+	await(t, l, padded, unpadded, all)
+
+	l.Publish(&local.RouteEvent{Vpc: otherVPC, Network: "10.9.9.0/24"})
+	l.Publish(&local.RouteEvent{Vpc: "4d2", Network: "10.1.1.0/24"})
+	for name, events := range map[string]<-chan *local.RouteEvent{"padded": padded, "unpadded": unpadded} {
+		if got := next(t, events); got != "10.1.1.0/24" {
+			t.Errorf("%s watcher event = %s, want 10.1.1.0/24", name, got)
+		}
+	}
+	for _, want := range []string{"10.9.9.0/24", "10.1.1.0/24"} {
+		if got := next(t, all); got != want {
+			t.Errorf("watcher of all VPCs event = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestWatchSlowWatcher(t *testing.T) {
+	l := &local.Local{}
+	client := serve(t, l)
+	stream := watch(t, client, vpc)
+	// receive the first event only, then stop reading
+	first := make(chan *local.RouteEvent, 1)
+	go func() {
+		if event, err := stream.Recv(); err == nil {
+			first <- event
+		}
+	}()
+	await(t, l, first)
+
+	// publishing does not block on the watcher, its events are dropped
+	// once the buffers of the stream are full
+	const count = 10000
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := range count {
+			l.Publish(&local.RouteEvent{
+				Vpc:          vpc,
+				Network:      fmt.Sprintf("10.%d.%d.0/24", i/256, i%256),
+				Srv6Segments: []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"},
+			})
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish() blocked on a slow watcher")
+	}
+
+	events := receive(stream)
+	received := 0
+	for drained := false; !drained; {
+		select {
+		case <-events:
+			received++
+		case <-time.After(200 * time.Millisecond):
+			drained = true
+		}
+	}
+	if received >= count {
+		t.Errorf("slow watcher received %d events, want some of %d dropped", received, count)
+	}
+
+	// the watcher keeps receiving once it caught up
+	l.Publish(&local.RouteEvent{Vpc: vpc, Network: "10.1.1.0/24"})
+	if got := next(t, events); got != "10.1.1.0/24" {
+		t.Errorf("event after catching up = %s, want 10.1.1.0/24", got)
+	}
+}
@@ -0,0 +1,137 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// PeerCredentials is a gRPC transport credential for unix sockets that
+// attaches the SO_PEERCRED of the caller to every connection.
+type PeerCredentials struct{}
+
+type PeerAuthInfo struct {
+	credentials.CommonAuthInfo
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+func (PeerAuthInfo) AuthType() string {
+	return "peercred"
+}
+
+func (PeerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil, fmt.Errorf("peercred: not a unix connection: %T", conn)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, nil, err
+	}
+	var ucred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, nil, err
+	}
+	if credErr != nil {
+		return nil, nil, fmt.Errorf("peercred: %w", credErr)
+	}
+	return conn, PeerAuthInfo{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity},
+		PID:            ucred.Pid,
+		UID:            ucred.Uid,
+		GID:            ucred.Gid,
+	}, nil
+}
+
+func (PeerCredentials) ClientHandshake(_ context.Context, _ string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, PeerAuthInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}, nil
+}
+
+func (PeerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "peercred"}
+}
+
+func (c PeerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (PeerCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// Rule grants callers whose uid is in UIDs or whose gid is in GIDs access to
+// the VPCs listed in VPCs, or to every VPC if VPCs is empty.
+type Rule struct {
+	UIDs []uint32
+	GIDs []uint32
+	VPCs []string
+}
+
+func (r Rule) matches(info PeerAuthInfo) bool {
+	return slices.Contains(r.UIDs, info.UID) || slices.Contains(r.GIDs, info.GID)
+}
+
+func (r Rule) allows(vpc string) bool {
+	if len(r.VPCs) == 0 {
+		return true
+	}
+	if vpc == "" {
+		return false
+	}
+	return slices.ContainsFunc(r.VPCs, func(v string) bool {
+		return normalizeID(v) == normalizeID(vpc)
+	})
+}
+
+// peerRules returns the rules matching the caller in ctx, failing if the
+// caller is not allowed to use the API at all.
+func (l *Local) peerRules(ctx context.Context) ([]Rule, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing peer")
+	}
+	info, ok := p.AuthInfo.(PeerAuthInfo)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing peer credentials")
+	}
+	var rules []Rule
+	for _, rule := range l.Rules {
+		if rule.matches(info) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, status.Errorf(codes.PermissionDenied, "peer not allowed: pid=%d, uid=%d, gid=%d", info.PID, info.UID, info.GID)
+	}
+	return rules, nil
+}
+
+// authorize checks that the caller in ctx may act on vpc. An empty vpc
+// stands for all VPCs.
+func (l *Local) authorize(ctx context.Context, vpc string) error {
+	if len(l.Rules) == 0 {
+		return nil
+	}
+	rules, err := l.peerRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.allows(vpc) {
+			return nil
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "peer not allowed for vpc '%s'", vpc)
+}
@@ -0,0 +1,88 @@
+package local_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/datum-cloud/galactic-agent/api/local"
+)
+
+const (
+	vpc           = "0000000004d2"
+	otherVPC      = "0000000004d3"
+	vpcAttachment = "002a"
+)
+
+// serve runs l on a unix socket in a temporary directory and returns a
+// client connected to it.
+func serve(t *testing.T, l *local.Local) local.LocalClient {
+	t.Helper()
+	l.SocketPath = filepath.Join(t.TempDir(), "agent.sock")
+	l.SocketUID = -1
+	l.SocketGID = -1
+	l.RegisterHandler = func(string, string, []string) error { return nil }
+	l.DeregisterHandler = func(string, string, []string) error { return nil }
+	l.DescribeHandler = func(string, string) (*local.Attachment, error) { return &local.Attachment{}, nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Serve(ctx)
+	}()
+	conn, err := grpc.NewClient("unix://"+l.SocketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		cancel()
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close() //nolint:errcheck
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+	return local.NewLocalClient(conn)
+}
+
+func register(client local.LocalClient, vpc string) error {
+	_, err := client.Register(context.Background(), &local.RegisterRequest{
+		Vpc:           vpc,
+		Vpcattachment: vpcAttachment,
+		Networks:      []string{"10.1.1.0/24"},
+	}, grpc.WaitForReady(true))
+	return err
+}
+
+func TestPeerCredentials(t *testing.T) {
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+	tests := []struct {
+		name  string
+		rules []local.Rule
+		vpc   string
+		want  codes.Code
+	}{
+		{"NoRules", nil, vpc, codes.OK},
+		{"AllowedUID", []local.Rule{{UIDs: []uint32{uid}}}, vpc, codes.OK},
+		{"AllowedGID", []local.Rule{{GIDs: []uint32{gid}}}, vpc, codes.OK},
+		{"DeniedUID", []local.Rule{{UIDs: []uint32{uid + 1}}}, vpc, codes.PermissionDenied},
+		{"AllowedVPC", []local.Rule{{UIDs: []uint32{uid}, VPCs: []string{"4d2"}}}, vpc, codes.OK},
+		{"DeniedVPC", []local.Rule{{UIDs: []uint32{uid}, VPCs: []string{vpc}}}, otherVPC, codes.PermissionDenied},
+		{"VPCOfOtherPeer", []local.Rule{{UIDs: []uint32{uid}, VPCs: []string{vpc}}, {UIDs: []uint32{uid + 1}}}, otherVPC, codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := serve(t, &local.Local{Rules: tt.rules})
+			if got := status.Code(register(client, tt.vpc)); got != tt.want {
+				t.Errorf("Register() code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package local
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// save writes all registrations to StorePath, replacing the previous
+// contents atomically. l.mu must be held.
+func (l *Local) save() error {
+	if l.StorePath == "" {
+		return nil
+	}
+	registrations := l.registrationsLocked()
+	sort.Slice(registrations, func(i, j int) bool {
+		if registrations[i].VPC != registrations[j].VPC {
+			return registrations[i].VPC < registrations[j].VPC
+		}
+		return registrations[i].VPCAttachment < registrations[j].VPCAttachment
+	})
+	data, err := json.MarshalIndent(registrations, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.StorePath), 0o700); err != nil {
+		return err
+	}
+	tmp := l.StorePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.StorePath)
+}
+
+// Restore loads the registrations saved at StorePath, replacing the current
+// ones, and returns them. A missing file restores nothing.
+func (l *Local) Restore() ([]Registration, error) {
+	if l.StorePath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(l.StorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var registrations []Registration
+	if err := json.Unmarshal(data, &registrations); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.registrations = make(map[registration]Registration, len(registrations))
+	for _, reg := range registrations {
+		// stores written before ids were normalized may hold an
+		// attachment under both its padded and unpadded ids
+		key := registrationKey(reg.VPC, reg.VPCAttachment)
+		if saved, ok := l.registrations[key]; ok {
+			for _, n := range reg.Networks {
+				if !slices.Contains(saved.Networks, n) {
+					saved.Networks = append(saved.Networks, n)
+				}
+			}
+			reg = saved
+		}
+		l.registrations[key] = reg
+	}
+	return l.registrationsLocked(), nil
+}
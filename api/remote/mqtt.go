@@ -0,0 +1,192 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type MQTT struct {
+	URL      string
+	ClientID string
+	Username string
+	Password string
+	QoS      byte
+	TopicRX  string
+	TopicTX  string
+	// TLS is used for ssl://, tls://, mqtts:// and wss:// URLs, reloaded on
+	// every connect attempt.
+	TLS *TLSFiles
+
+	will []byte
+
+	mu         sync.Mutex
+	client     mqtt.Client
+	handler    mqtt.MessageHandler
+	subscribed atomic.Bool
+	topics     topicSet
+}
+
+func (m *MQTT) Run(ctx context.Context, receive func([]byte), connected func()) error {
+	log.Printf("MQTT connecting")
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(m.URL)
+	if m.ClientID != "" {
+		opts.SetClientID(m.ClientID)
+	}
+	if m.Username != "" {
+		opts.SetUsername(m.Username)
+	}
+	if m.Password != "" {
+		opts.SetPassword(m.Password)
+	}
+	if m.TLS != nil {
+		tlsConfig, err := m.TLS.Config()
+		if err != nil {
+			return fmt.Errorf("mqtt tls: %w", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+		opts.SetConnectionAttemptHandler(func(_ *url.URL, _ *tls.Config) *tls.Config {
+			config, err := m.TLS.Config()
+			if err != nil {
+				// e.g. a secret half way through rotation
+				log.Printf("MQTT TLS reload failed, using previous config: %v", err)
+				return tlsConfig
+			}
+			tlsConfig = config
+			return config
+		})
+	}
+	if m.will != nil {
+		opts.SetBinaryWill(m.TopicTX, m.will, m.QoS, false)
+	}
+	opts.SetCleanSession(m.ClientID == "" || m.QoS == 0)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(retryMin)
+	opts.SetMaxReconnectInterval(retryMax)
+
+	handler := func(_ mqtt.Client, msg mqtt.Message) {
+		receive(msg.Payload())
+	}
+	opts.OnConnect = func(c mqtt.Client) {
+		log.Println("MQTT connected")
+		err := m.topics.resubscribe(m.TopicRX, func(topics []string) error {
+			filters := make(map[string]byte, len(topics))
+			for _, topic := range topics {
+				filters[topic] = m.QoS
+			}
+			token := c.SubscribeMultiple(filters, handler)
+			if !token.WaitTimeout(5 * time.Second) {
+				return fmt.Errorf("subscribe timed out after %s", 5*time.Second)
+			}
+			if err := token.Error(); err != nil {
+				return err
+			}
+			m.subscribed.Store(true)
+			log.Printf("MQTT subscribed: %s", topics)
+			return nil
+		})
+		if err != nil {
+			log.Printf("MQTT subscribe error: %v", err)
+			return
+		}
+		connected()
+	}
+	opts.OnConnectionLost = func(_ mqtt.Client, err error) {
+		m.subscribed.Store(false)
+		log.Printf("MQTT connection lost: %v", err)
+	}
+
+	client := mqtt.NewClient(opts)
+	m.mu.Lock()
+	m.client = client
+	m.handler = handler
+	m.mu.Unlock()
+	// with ConnectRetry the token only completes once connected, so the
+	// agent keeps running while the broker is unreachable
+	client.Connect()
+
+	<-ctx.Done()
+	if client.IsConnected() {
+		client.Disconnect(250)
+	}
+	log.Println("MQTT disconnected")
+
+	return nil
+}
+
+func (m *MQTT) SetLastWill(payload []byte) {
+	m.will = payload
+}
+
+func (m *MQTT) Send(payload []byte) error {
+	m.mu.Lock()
+	client := m.client
+	m.mu.Unlock()
+	if client == nil || !client.IsConnectionOpen() {
+		return ErrNotConnected
+	}
+	token := client.Publish(m.TopicTX, m.QoS, false, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("publish timed out after %s", publishTimeout)
+	}
+	return token.Error()
+}
+
+// Connected reports whether the client is connected and subscribed to
+// TopicRX.
+func (m *MQTT) Connected() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.client != nil && m.client.IsConnectionOpen() && m.subscribed.Load()
+}
+
+// Subscribe adds topic to the subscriptions, subscribing right away if
+// connected.
+func (m *MQTT) Subscribe(topic string) error {
+	return m.topics.add(topic, func(topic string) error {
+		m.mu.Lock()
+		client, handler := m.client, m.handler
+		m.mu.Unlock()
+		if client == nil || !m.Connected() {
+			return nil
+		}
+		token := client.Subscribe(topic, m.QoS, handler)
+		if !token.WaitTimeout(publishTimeout) {
+			return fmt.Errorf("subscribe timed out after %s", publishTimeout)
+		}
+		if err := token.Error(); err != nil {
+			return err
+		}
+		log.Printf("MQTT subscribed: %s", topic)
+		return nil
+	})
+}
+
+func (m *MQTT) Unsubscribe(topic string) error {
+	return m.topics.remove(topic, func(topic string) error {
+		m.mu.Lock()
+		client := m.client
+		m.mu.Unlock()
+		if client == nil || !m.Connected() {
+			return nil
+		}
+		token := client.Unsubscribe(topic)
+		if !token.WaitTimeout(publishTimeout) {
+			return fmt.Errorf("unsubscribe timed out after %s", publishTimeout)
+		}
+		if err := token.Error(); err != nil {
+			return err
+		}
+		log.Printf("MQTT unsubscribed: %s", topic)
+		return nil
+	})
+}
@@ -0,0 +1,364 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/datum-cloud/galactic-agent/metrics"
+)
+
+// SchemaVersion identifies the payload schema in the "schema_version" user
+// property of MQTT v5 messages.
+const SchemaVersion = "remote.v1"
+
+const (
+	keepAlive     = 30
+	sessionExpiry = uint32(time.Hour / time.Second)
+)
+
+// MQTTv5 is an MQTT v5 transport. Published messages carry the
+// "schema_version" and "node_id" user properties and name ResponseTopic for
+// replies such as the Snapshot to a SyncRequest. Heartbeats and Acks expire
+// after MessageExpiry. Inbound messages with a different schema_version are
+// dropped.
+type MQTTv5 struct {
+	URL      string
+	ClientID string
+	Username string
+	Password string
+	QoS      byte
+	TopicRX  string
+	TopicTX  string
+	// TLS is used for ssl://, tls:// and mqtts:// URLs, reloaded on every
+	// connect attempt. ws:// and wss:// URLs are not supported with TLS.
+	TLS    *TLSFiles
+	NodeID string
+	// MessageExpiry of published Heartbeats and Acks, which are superseded
+	// by the next ones, 0 never expires. Registrations and presence never
+	// expire, so that a controller that was offline still receives them.
+	MessageExpiry time.Duration
+	// ResponseTopic defaults to TopicRX.
+	ResponseTopic string
+
+	will []byte
+
+	mu         sync.Mutex
+	conn       *autopaho.ConnectionManager
+	subscribed atomic.Bool
+	topics     topicSet
+}
+
+func (m *MQTTv5) SetLastWill(payload []byte) {
+	m.will = payload
+}
+
+// reasonCode records an MQTT v5 reason code, logging failures (>= 0x80).
+func reasonCode(packet string, code byte, reason string) error {
+	metrics.MQTTReasonCodes.WithLabelValues(packet, fmt.Sprintf("0x%02x", code)).Inc()
+	if code < 0x80 {
+		return nil
+	}
+	err := fmt.Errorf("%s reason code 0x%02x", packet, code)
+	if reason != "" {
+		err = fmt.Errorf("%w: %s", err, reason)
+	}
+	return err
+}
+
+func (m *MQTTv5) dial(ctx context.Context, u *url.URL) (net.Conn, error) {
+	switch strings.ToLower(u.Scheme) {
+	case "mqtt", "tcp", "":
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", u.Host)
+	case "ssl", "tls", "mqtts":
+	default:
+		return nil, fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	}
+	config, err := m.TLS.Config()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	d := tls.Dialer{Config: config}
+	conn, err := d.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	return packets.NewThreadSafeConn(conn), nil
+}
+
+func (m *MQTTv5) Run(ctx context.Context, receive func([]byte), connected func()) error {
+	log.Printf("MQTTv5 connecting")
+
+	u, err := url.Parse(m.URL)
+	if err != nil {
+		return fmt.Errorf("mqtt url: %w", err)
+	}
+	if scheme := strings.ToLower(u.Scheme); m.TLS != nil && (scheme == "ws" || scheme == "wss") {
+		return fmt.Errorf("mqtt url: scheme '%s' is not supported with tls", u.Scheme)
+	}
+	config := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		KeepAlive:                     keepAlive,
+		CleanStartOnInitialConnection: m.ClientID == "" || m.QoS == 0,
+		ReconnectBackoff:              autopaho.NewExponentialBackoff(retryMin, retryMax, retryMin, 2),
+		ConnectUsername:               m.Username,
+		ConnectPassword:               []byte(m.Password),
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+			log.Println("MQTTv5 connected")
+			reasonCode("connack", connack.ReasonCode, "") //nolint:errcheck
+			// OnConnectionUp must not block
+			go m.subscribe(ctx, cm, connected)
+		},
+		OnConnectionDown: func() bool {
+			m.subscribed.Store(false)
+			log.Println("MQTTv5 connection lost")
+			return true
+		},
+		OnConnectError: func(err error) {
+			var connackErr *autopaho.ConnackError
+			if errors.As(err, &connackErr) {
+				err = errors.Join(err, reasonCode("connack", connackErr.ReasonCode, connackErr.Reason))
+			}
+			log.Printf("MQTTv5 connect error: %v", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: m.ClientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					if schema, ok := acceptSchema(pr.Packet.Properties); !ok {
+						log.Printf("MQTTv5 dropped message: schema_version='%s'", schema)
+						return true, nil
+					}
+					receive(pr.Packet.Payload)
+					return true, nil
+				},
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				var reason string
+				if d.Properties != nil {
+					reason = d.Properties.ReasonString
+				}
+				log.Printf("MQTTv5 server disconnect: %v", reasonCode("disconnect", d.ReasonCode, reason))
+			},
+			OnClientError: func(err error) {
+				log.Printf("MQTTv5 client error: %v", err)
+			},
+		},
+	}
+	if !config.CleanStartOnInitialConnection {
+		// keep the subscription and queued QoS 1 messages while reconnecting
+		config.SessionExpiryInterval = sessionExpiry
+	}
+	if m.TLS != nil {
+		if _, err := m.TLS.Config(); err != nil {
+			return fmt.Errorf("mqtt tls: %w", err)
+		}
+		config.AttemptConnection = func(ctx context.Context, _ autopaho.ClientConfig, u *url.URL) (net.Conn, error) {
+			return m.dial(ctx, u)
+		}
+	}
+	if m.will != nil {
+		config.WillMessage = &paho.WillMessage{
+			Topic:   m.TopicTX,
+			QoS:     m.QoS,
+			Payload: m.will,
+		}
+		config.WillProperties = &paho.WillProperties{
+			User: m.userProperties(),
+		}
+	}
+	cm, err := autopaho.NewConnection(ctx, config)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.conn = cm
+	m.mu.Unlock()
+
+	<-ctx.Done()
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if err := cm.Disconnect(disconnectCtx); err != nil && !errors.Is(err, autopaho.ConnectionDownError) {
+		log.Printf("MQTTv5 disconnect failed: %v", err)
+	}
+	<-cm.Done()
+	log.Println("MQTTv5 disconnected")
+	return nil
+}
+
+func subackErr(suback *paho.Suback, err error) error {
+	if err != nil {
+		return err
+	}
+	var reason string
+	if suback.Properties != nil {
+		reason = suback.Properties.ReasonString
+	}
+	for _, code := range suback.Reasons {
+		err = errors.Join(err, reasonCode("suback", code, reason))
+	}
+	return err
+}
+
+func (m *MQTTv5) subscribe(ctx context.Context, cm *autopaho.ConnectionManager, connected func()) {
+	err := m.topics.resubscribe(m.TopicRX, func(topics []string) error {
+		subscriptions := make([]paho.SubscribeOptions, 0, len(topics))
+		for _, topic := range topics {
+			subscriptions = append(subscriptions, paho.SubscribeOptions{Topic: topic, QoS: m.QoS})
+		}
+		suback, err := cm.Subscribe(ctx, &paho.Subscribe{Subscriptions: subscriptions})
+		if err := subackErr(suback, err); err != nil {
+			return err
+		}
+		m.subscribed.Store(true)
+		log.Printf("MQTTv5 subscribed: %s", topics)
+		return nil
+	})
+	if err != nil {
+		log.Printf("MQTTv5 subscribe error: %v", err)
+		return
+	}
+	connected()
+}
+
+// Subscribe adds topic to the subscriptions, subscribing right away if
+// connected.
+func (m *MQTTv5) Subscribe(topic string) error {
+	return m.topics.add(topic, func(topic string) error {
+		m.mu.Lock()
+		cm := m.conn
+		m.mu.Unlock()
+		if cm == nil || !m.Connected() {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+		suback, err := cm.Subscribe(ctx, &paho.Subscribe{
+			Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: m.QoS}},
+		})
+		if err := subackErr(suback, err); err != nil {
+			return err
+		}
+		log.Printf("MQTTv5 subscribed: %s", topic)
+		return nil
+	})
+}
+
+func (m *MQTTv5) Unsubscribe(topic string) error {
+	return m.topics.remove(topic, func(topic string) error {
+		m.mu.Lock()
+		cm := m.conn
+		m.mu.Unlock()
+		if cm == nil || !m.Connected() {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+		unsuback, err := cm.Unsubscribe(ctx, &paho.Unsubscribe{Topics: []string{topic}})
+		if err != nil {
+			return err
+		}
+		for _, code := range unsuback.Reasons {
+			err = errors.Join(err, reasonCode("unsuback", code, ""))
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("MQTTv5 unsubscribed: %s", topic)
+		return nil
+	})
+}
+
+func (m *MQTTv5) userProperties() paho.UserProperties {
+	var user paho.UserProperties
+	user.Add("schema_version", SchemaVersion)
+	if m.NodeID != "" {
+		user.Add("node_id", m.NodeID)
+	}
+	return user
+}
+
+// acceptSchema returns the schema_version of an inbound message and whether
+// it is accepted, which it is when absent or equal to SchemaVersion.
+func acceptSchema(properties *paho.PublishProperties) (string, bool) {
+	if properties == nil {
+		return "", true
+	}
+	schema := properties.User.Get("schema_version")
+	return schema, schema == "" || schema == SchemaVersion
+}
+
+// expires reports whether payload is an envelope that is superseded by later
+// ones and so may expire.
+func expires(payload []byte) bool {
+	envelope := &Envelope{}
+	if err := proto.Unmarshal(payload, envelope); err != nil {
+		return false
+	}
+	switch envelope.Kind.(type) {
+	case *Envelope_Heartbeat, *Envelope_Ack:
+		return true
+	}
+	return false
+}
+
+func (m *MQTTv5) publishProperties(payload []byte) *paho.PublishProperties {
+	properties := &paho.PublishProperties{
+		ResponseTopic: m.ResponseTopic,
+		User:          m.userProperties(),
+	}
+	if properties.ResponseTopic == "" {
+		properties.ResponseTopic = m.TopicRX
+	}
+	if m.MessageExpiry > 0 && expires(payload) {
+		expiry := uint32(m.MessageExpiry / time.Second)
+		properties.MessageExpiry = &expiry
+	}
+	return properties
+}
+
+func (m *MQTTv5) Send(payload []byte) error {
+	m.mu.Lock()
+	cm := m.conn
+	m.mu.Unlock()
+	if cm == nil || !m.subscribed.Load() {
+		return ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	response, err := cm.Publish(ctx, &paho.Publish{
+		QoS:        m.QoS,
+		Topic:      m.TopicTX,
+		Payload:    payload,
+		Properties: m.publishProperties(payload),
+	})
+	if response != nil {
+		var reason string
+		if response.Properties != nil {
+			reason = response.Properties.ReasonString
+		}
+		err = errors.Join(err, reasonCode("puback", response.ReasonCode, reason))
+	}
+	return err
+}
+
+// Connected reports whether the client is connected and subscribed to
+// TopicRX.
+func (m *MQTTv5) Connected() bool {
+	return m.subscribed.Load()
+}
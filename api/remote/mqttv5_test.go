@@ -0,0 +1,125 @@
+package remote
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReasonCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   byte
+		reason string
+		want   string
+	}{
+		{"Success", 0x00, "", ""},
+		{"GrantedQoS1", 0x01, "", ""},
+		{"Failure", 0x87, "", "suback reason code 0x87"},
+		{"FailureWithReason", 0x87, "not authorized", "suback reason code 0x87: not authorized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := reasonCode("suback", tt.code, tt.reason)
+			var got string
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("reasonCode() error = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptSchema(t *testing.T) {
+	properties := func(schema string) *paho.PublishProperties {
+		var user paho.UserProperties
+		user.Add("schema_version", schema)
+		return &paho.PublishProperties{User: user}
+	}
+	tests := []struct {
+		name       string
+		properties *paho.PublishProperties
+		want       bool
+	}{
+		{"NoProperties", nil, true},
+		{"NoSchema", &paho.PublishProperties{}, true},
+		{"Current", properties(SchemaVersion), true},
+		{"Other", properties("remote.v2"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := acceptSchema(tt.properties); got != tt.want {
+				t.Errorf("acceptSchema() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishProperties(t *testing.T) {
+	payload := func(envelope *Envelope) []byte {
+		data, err := proto.Marshal(envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	heartbeat := payload(&Envelope{Kind: &Envelope_Heartbeat{Heartbeat: &Heartbeat{}}})
+	register := payload(&Envelope{Kind: &Envelope_Register{Register: &Register{}}})
+
+	m := &MQTTv5{TopicRX: "rx", NodeID: "node-1"}
+	properties := m.publishProperties(heartbeat)
+	if properties.ResponseTopic != "rx" {
+		t.Errorf("ResponseTopic = %q, want %q", properties.ResponseTopic, "rx")
+	}
+	if properties.MessageExpiry != nil {
+		t.Errorf("MessageExpiry = %d, want none", *properties.MessageExpiry)
+	}
+	if got := properties.User.Get("schema_version"); got != SchemaVersion {
+		t.Errorf("schema_version = %q, want %q", got, SchemaVersion)
+	}
+	if got := properties.User.Get("node_id"); got != "node-1" {
+		t.Errorf("node_id = %q, want %q", got, "node-1")
+	}
+
+	m = &MQTTv5{TopicRX: "rx", ResponseTopic: "reply", MessageExpiry: 90 * time.Second}
+	properties = m.publishProperties(heartbeat)
+	if properties.ResponseTopic != "reply" {
+		t.Errorf("ResponseTopic = %q, want %q", properties.ResponseTopic, "reply")
+	}
+	if properties.MessageExpiry == nil || *properties.MessageExpiry != 90 {
+		t.Errorf("MessageExpiry = %v, want 90", properties.MessageExpiry)
+	}
+	for _, p := range properties.User {
+		if p.Key == "node_id" {
+			t.Errorf("node_id = %q, want none", p.Value)
+		}
+	}
+
+	// registrations must reach a controller that was offline
+	if properties = m.publishProperties(register); properties.MessageExpiry != nil {
+		t.Errorf("Register MessageExpiry = %d, want none", *properties.MessageExpiry)
+	}
+}
+
+func TestMQTTv5Schemes(t *testing.T) {
+	for _, scheme := range []string{"ws", "wss"} {
+		m := &MQTTv5{URL: scheme + "://mqtt:8083", TLS: &TLSFiles{}}
+		if err := m.Run(context.Background(), func([]byte) {}, func() {}); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Errorf("Run(%s) error = %v, want not supported", scheme, err)
+		}
+	}
+
+	m := &MQTTv5{TLS: &TLSFiles{}}
+	if _, err := m.dial(context.Background(), &url.URL{Scheme: "quic", Host: "mqtt:1883"}); err == nil {
+		t.Error("dial(quic) error = nil, want unsupported scheme")
+	}
+}
@@ -0,0 +1,108 @@
+package remote
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nats-io/nats.go"
+)
+
+type NATS struct {
+	URL       string
+	Name      string
+	Username  string
+	Password  string
+	Token     string
+	SubjectRX string
+	SubjectTX string
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+func (n *NATS) Run(ctx context.Context, receive func([]byte), connected func()) error {
+	log.Printf("NATS connecting")
+
+	// the initial connect may complete before or after the subscription
+	// below exists; only announce it once both are in place
+	var subscribed atomic.Bool
+	var initial sync.Once
+	opts := []nats.Option{
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(retryMin),
+		nats.ConnectHandler(func(_ *nats.Conn) {
+			log.Println("NATS connected")
+			if subscribed.Load() {
+				initial.Do(connected)
+			}
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			log.Println("NATS reconnected")
+			connected()
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Printf("NATS connection lost: %v", err)
+		}),
+	}
+	if n.Name != "" {
+		opts = append(opts, nats.Name(n.Name))
+	}
+	if n.Username != "" {
+		opts = append(opts, nats.UserInfo(n.Username, n.Password))
+	}
+	if n.Token != "" {
+		opts = append(opts, nats.Token(n.Token))
+	}
+
+	conn, err := nats.Connect(n.URL, opts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// subscriptions are restored by the client on reconnect
+	if _, err := conn.Subscribe(n.SubjectRX, func(msg *nats.Msg) {
+		receive(msg.Data)
+	}); err != nil {
+		return err
+	}
+	log.Printf("NATS subscribed: %s", n.SubjectRX)
+
+	n.mu.Lock()
+	n.conn = conn
+	n.mu.Unlock()
+	subscribed.Store(true)
+	if conn.IsConnected() {
+		initial.Do(connected)
+	}
+
+	<-ctx.Done()
+	if err := conn.Drain(); err != nil {
+		log.Printf("NATS drain failed: %v", err)
+	}
+	log.Println("NATS disconnected")
+
+	return nil
+}
+
+func (n *NATS) Send(payload []byte) error {
+	n.mu.Lock()
+	conn := n.conn
+	n.mu.Unlock()
+	if conn == nil || !conn.IsConnected() {
+		return ErrNotConnected
+	}
+	if err := conn.Publish(n.SubjectTX, payload); err != nil {
+		return err
+	}
+	return conn.FlushTimeout(publishTimeout)
+}
+
+func (n *NATS) Connected() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.conn != nil && n.conn.IsConnected()
+}
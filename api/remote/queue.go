@@ -0,0 +1,139 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/datum-cloud/galactic-agent/metrics"
+)
+
+var ErrQueueFull = errors.New("outbound queue full")
+
+const queueFileSuffix = ".msg"
+
+type queueItem struct {
+	seq     uint64
+	payload []byte
+}
+
+// queue is a bounded FIFO of outbound payloads. If dir is set every item is
+// also written to its own file so that pending messages survive a restart.
+type queue struct {
+	size   int
+	dir    string
+	mu     sync.Mutex
+	items  []queueItem
+	seq    uint64
+	notify chan struct{}
+}
+
+func openQueue(size int, dir string) (*queue, error) {
+	q := &queue{
+		size:   size,
+		dir:    dir,
+		notify: make(chan struct{}, 1),
+	}
+	if dir == "" {
+		return q, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), queueFileSuffix)
+		if !ok {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		payload, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		q.items = append(q.items, queueItem{seq: seq, payload: payload})
+	}
+	sort.Slice(q.items, func(i, j int) bool {
+		return q.items[i].seq < q.items[j].seq
+	})
+	if n := len(q.items); n > 0 {
+		q.seq = q.items[n-1].seq
+	}
+	metrics.QueueDepth.Set(float64(len(q.items)))
+	return q, nil
+}
+
+func (q *queue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, queueFileSuffix))
+}
+
+func (q *queue) push(payload []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.size > 0 && len(q.items) >= q.size {
+		return ErrQueueFull
+	}
+
+	item := queueItem{seq: q.seq + 1, payload: payload}
+	if q.dir != "" {
+		tmp := q.path(item.seq) + ".tmp"
+		if err := os.WriteFile(tmp, payload, 0o600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, q.path(item.seq)); err != nil {
+			return err
+		}
+	}
+	q.seq = item.seq
+	q.items = append(q.items, item)
+	metrics.QueueDepth.Set(float64(len(q.items)))
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *queue) peek() (queueItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return queueItem{}, false
+	}
+	return q.items[0], true
+}
+
+func (q *queue) pop(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 || q.items[0].seq != seq {
+		return nil
+	}
+	q.items = q.items[1:]
+	metrics.QueueDepth.Set(float64(len(q.items)))
+	if q.dir != "" {
+		if err := os.Remove(q.path(seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
@@ -0,0 +1,104 @@
+package remote
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestQueueReplay(t *testing.T) {
+	dir := t.TempDir()
+	q, err := openQueue(10, dir)
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+	for _, payload := range []string{"a", "b", "c"} {
+		if err := q.push([]byte(payload)); err != nil {
+			t.Fatalf("push() error = %v", err)
+		}
+	}
+	item, _ := q.peek()
+	if err := q.pop(item.seq); err != nil {
+		t.Fatalf("pop() error = %v", err)
+	}
+
+	// a restarted agent replays the remaining items in order
+	q, err = openQueue(10, dir)
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+	var got []string
+	for {
+		item, ok := q.peek()
+		if !ok {
+			break
+		}
+		got = append(got, string(item.payload))
+		if err := q.pop(item.seq); err != nil {
+			t.Fatalf("pop() error = %v", err)
+		}
+	}
+	if len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("replayed %v, want [b c]", got)
+	}
+
+	// new items continue after the replayed ones
+	if err := q.push([]byte("d")); err != nil {
+		t.Fatalf("push() error = %v", err)
+	}
+	if item, _ := q.peek(); item.seq <= 3 {
+		t.Errorf("push() after replay got seq %d, want > 3", item.seq)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q, err := openQueue(2, "")
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+	for range 2 {
+		if err := q.push([]byte("a")); err != nil {
+			t.Fatalf("push() error = %v", err)
+		}
+	}
+	if err := q.push([]byte("b")); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("push() error = %v, want %v", err, ErrQueueFull)
+	}
+	if n := q.len(); n != 2 {
+		t.Errorf("len() = %d, want 2", n)
+	}
+}
+
+func TestQueuePopRemovesFile(t *testing.T) {
+	dir := t.TempDir()
+	q, err := openQueue(10, dir)
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+	if err := q.push([]byte("a")); err != nil {
+		t.Fatalf("push() error = %v", err)
+	}
+	item, _ := q.peek()
+	if _, err := os.Stat(q.path(item.seq)); err != nil {
+		t.Fatalf("queued item not persisted: %v", err)
+	}
+
+	// popping a sequence other than the head is a no-op
+	if err := q.pop(item.seq + 1); err != nil {
+		t.Fatalf("pop() error = %v", err)
+	}
+	if n := q.len(); n != 1 {
+		t.Fatalf("len() = %d after popping another seq, want 1", n)
+	}
+
+	if err := q.pop(item.seq); err != nil {
+		t.Fatalf("pop() error = %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("queue dir has %d entries after pop, want 0", len(entries))
+	}
+}
@@ -2,75 +2,174 @@ package remote
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/datum-cloud/galactic-agent/metrics"
 )
 
+const (
+	DefaultQueueSize = 1024
+
+	retryMin       = time.Second
+	retryMax       = 30 * time.Second
+	publishTimeout = 10 * time.Second
+)
+
+// Remote exchanges envelopes with the controller over a Transport, queueing
+// outbound payloads while the transport is disconnected.
 type Remote struct {
-	URL            string
-	ClientID       string
-	Username       string
-	Password       string
-	QoS            byte
-	TopicRX        string
-	TopicTX        string
+	Transport      Transport
 	ReceiveHandler func([]byte) error
+	// ConnectHandler is called after every (re)connect once inbound
+	// messages are subscribed.
+	ConnectHandler func() error
+	// QueueSize bounds the number of payloads held while the broker is
+	// unreachable. QueueDir, if set, persists them across restarts.
+	QueueSize int
+	QueueDir  string
+	// Goodbye, if set, is published directly when Run's ctx is done, before
+	// the transport disconnects.
+	Goodbye []byte
 
-	client mqtt.Client
+	queueOnce sync.Once
+	queue     *queue
+	queueErr  error
 }
 
-func (r *Remote) Run(ctx context.Context) error {
-	log.Printf("MQTT connecting")
+func (r *Remote) outbox() (*queue, error) {
+	r.queueOnce.Do(func() {
+		size := r.QueueSize
+		if size <= 0 {
+			size = DefaultQueueSize
+		}
+		r.queue, r.queueErr = openQueue(size, r.QueueDir)
+	})
+	return r.queue, r.queueErr
+}
 
-	opts := mqtt.NewClientOptions().
-		AddBroker(r.URL)
-	if r.ClientID != "" {
-		opts.SetClientID(r.ClientID)
+func (r *Remote) Run(ctx context.Context) error {
+	q, err := r.outbox()
+	if err != nil {
+		return fmt.Errorf("outbound queue: %w", err)
 	}
-	if r.Username != "" {
-		opts.SetUsername(r.Username)
+
+	// the transport outlives ctx until the goodbye has been published
+	transportCtx, cancelTransport := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelTransport()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	receive := func(payload []byte) {
+		if err := r.ReceiveHandler(payload); err != nil {
+			log.Printf("ReceiveHandler failed: %v", err)
+		}
 	}
-	if r.Password != "" {
-		opts.SetPassword(r.Password)
+	connected := func() {
+		log.Printf("Transport connected: queued=%d", q.len())
+		if r.ConnectHandler != nil {
+			if err := r.ConnectHandler(); err != nil {
+				log.Printf("ConnectHandler failed: %v", err)
+			}
+		}
+		select {
+		case q.notify <- struct{}{}:
+		default:
+		}
 	}
-	opts.SetCleanSession(r.ClientID == "" || r.QoS == 0)
-
-	opts.OnConnect = func(c mqtt.Client) {
-		log.Println("MQTT connected")
-		token := c.Subscribe(
-			r.TopicRX,
-			r.QoS,
-			func(_ mqtt.Client, msg mqtt.Message) {
-				payload := msg.Payload()
-				if err := r.ReceiveHandler(payload); err != nil {
-					log.Printf("MQTT ReceiveHandler failed: %v", err)
-				}
-			},
-		)
-		if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
-			log.Printf("MQTT subscribe error: %v", token.Error())
-			return
+
+	routineErr := make(chan error, 1)
+	go func() {
+		routineErr <- r.Transport.Run(transportCtx, receive, connected)
+		cancel()
+	}()
+
+	r.drain(ctx, q)
+	if r.Goodbye != nil && r.Transport.Connected() {
+		err := r.Transport.Send(r.Goodbye)
+		metrics.TransportPublish.WithLabelValues(metrics.Result(err)).Inc()
+		if err != nil {
+			log.Printf("Goodbye failed: %v", err)
 		}
-		log.Printf("MQTT subscribed: %s", r.TopicRX)
 	}
+	cancelTransport()
+	return <-routineErr
+}
 
-	r.client = mqtt.NewClient(opts)
-	if tok := r.client.Connect(); tok.Wait() && tok.Error() != nil {
-		return tok.Error()
+// drain publishes queued payloads in order until ctx is done, retrying with
+// exponential backoff while the transport is unavailable.
+func (r *Remote) drain(ctx context.Context, q *queue) {
+	backoff := retryMin
+	// wait sleeps for d, returning early on a (re)connect or a new payload
+	wait := func(d time.Duration) bool {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return false
+		case <-t.C:
+		case <-q.notify:
+		}
+		return true
 	}
 
-	<-ctx.Done()
-	if r.client.IsConnected() {
-		r.client.Disconnect(250)
+	for {
+		item, ok := q.peek()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.notify:
+			}
+			continue
+		}
+
+		if !r.Transport.Connected() {
+			if !wait(backoff) {
+				return
+			}
+			backoff = min(backoff*2, retryMax)
+			continue
+		}
+
+		err := r.Transport.Send(item.payload)
+		metrics.TransportPublish.WithLabelValues(metrics.Result(err)).Inc()
+		if err != nil {
+			log.Printf("Publish failed, retrying in %s: %v", backoff, err)
+			if !wait(backoff) {
+				return
+			}
+			backoff = min(backoff*2, retryMax)
+			continue
+		}
+		backoff = retryMin
+		if err := q.pop(item.seq); err != nil {
+			log.Printf("Outbound queue pop failed: %v", err)
+		}
 	}
-	log.Println("MQTT disconnected")
+}
 
+// Send queues payload for publishing. It fails if the outbound queue is
+// full or cannot be persisted.
+func (r *Remote) Send(payload []byte) error {
+	q, err := r.outbox()
+	if err != nil {
+		return fmt.Errorf("outbound queue: %w", err)
+	}
+	if err := q.push(payload); err != nil {
+		return fmt.Errorf("enqueue failed: %w", err)
+	}
 	return nil
 }
 
-func (r *Remote) Send(payload interface{}) {
-	token := r.client.Publish(r.TopicTX, r.QoS, false, payload)
-	token.Wait()
+// KindName returns the name of the oneof field set in envelope, e.g.
+// "register" or "route".
+func KindName(envelope *Envelope) string {
+	m := envelope.ProtoReflect()
+	if field := m.WhichOneof(m.Descriptor().Oneofs().ByName("kind")); field != nil {
+		return string(field.Name())
+	}
+	return "unknown"
 }
@@ -67,6 +67,52 @@ func (Route_Status) EnumDescriptor() ([]byte, []int) {
 	return file_remote_proto_rawDescGZIP(), []int{3, 0}
 }
 
+type Presence_Status int32
+
+const (
+	Presence_ONLINE  Presence_Status = 0
+	Presence_OFFLINE Presence_Status = 1
+)
+
+// Enum value maps for Presence_Status.
+var (
+	Presence_Status_name = map[int32]string{
+		0: "ONLINE",
+		1: "OFFLINE",
+	}
+	Presence_Status_value = map[string]int32{
+		"ONLINE":  0,
+		"OFFLINE": 1,
+	}
+)
+
+func (x Presence_Status) Enum() *Presence_Status {
+	p := new(Presence_Status)
+	*p = x
+	return p
+}
+
+func (x Presence_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Presence_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_remote_proto_enumTypes[1].Descriptor()
+}
+
+func (Presence_Status) Type() protoreflect.EnumType {
+	return &file_remote_proto_enumTypes[1]
+}
+
+func (x Presence_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Presence_Status.Descriptor instead.
+func (Presence_Status) EnumDescriptor() ([]byte, []int) {
+	return file_remote_proto_rawDescGZIP(), []int{7, 0}
+}
+
 type Envelope struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// Types that are valid to be assigned to Kind:
@@ -74,6 +120,12 @@ type Envelope struct {
 	//	*Envelope_Register
 	//	*Envelope_Deregister
 	//	*Envelope_Route
+	//	*Envelope_SyncRequest
+	//	*Envelope_Snapshot
+	//	*Envelope_Ack
+	//	*Envelope_Presence
+	//	*Envelope_Heartbeat
+	//	*Envelope_Resync
 	Kind          isEnvelope_Kind `protobuf_oneof:"kind"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -143,6 +195,60 @@ func (x *Envelope) GetRoute() *Route {
 	return nil
 }
 
+func (x *Envelope) GetSyncRequest() *SyncRequest {
+	if x != nil {
+		if x, ok := x.Kind.(*Envelope_SyncRequest); ok {
+			return x.SyncRequest
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetSnapshot() *Snapshot {
+	if x != nil {
+		if x, ok := x.Kind.(*Envelope_Snapshot); ok {
+			return x.Snapshot
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetAck() *Ack {
+	if x != nil {
+		if x, ok := x.Kind.(*Envelope_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetPresence() *Presence {
+	if x != nil {
+		if x, ok := x.Kind.(*Envelope_Presence); ok {
+			return x.Presence
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetHeartbeat() *Heartbeat {
+	if x != nil {
+		if x, ok := x.Kind.(*Envelope_Heartbeat); ok {
+			return x.Heartbeat
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetResync() *Resync {
+	if x != nil {
+		if x, ok := x.Kind.(*Envelope_Resync); ok {
+			return x.Resync
+		}
+	}
+	return nil
+}
+
 type isEnvelope_Kind interface {
 	isEnvelope_Kind()
 }
@@ -159,12 +265,48 @@ type Envelope_Route struct {
 	Route *Route `protobuf:"bytes,3,opt,name=route,proto3,oneof"`
 }
 
+type Envelope_SyncRequest struct {
+	SyncRequest *SyncRequest `protobuf:"bytes,4,opt,name=sync_request,json=syncRequest,proto3,oneof"`
+}
+
+type Envelope_Snapshot struct {
+	Snapshot *Snapshot `protobuf:"bytes,5,opt,name=snapshot,proto3,oneof"`
+}
+
+type Envelope_Ack struct {
+	Ack *Ack `protobuf:"bytes,6,opt,name=ack,proto3,oneof"`
+}
+
+type Envelope_Presence struct {
+	Presence *Presence `protobuf:"bytes,7,opt,name=presence,proto3,oneof"`
+}
+
+type Envelope_Heartbeat struct {
+	Heartbeat *Heartbeat `protobuf:"bytes,8,opt,name=heartbeat,proto3,oneof"`
+}
+
+type Envelope_Resync struct {
+	Resync *Resync `protobuf:"bytes,9,opt,name=resync,proto3,oneof"`
+}
+
 func (*Envelope_Register) isEnvelope_Kind() {}
 
 func (*Envelope_Deregister) isEnvelope_Kind() {}
 
 func (*Envelope_Route) isEnvelope_Kind() {}
 
+func (*Envelope_SyncRequest) isEnvelope_Kind() {}
+
+func (*Envelope_Snapshot) isEnvelope_Kind() {}
+
+func (*Envelope_Ack) isEnvelope_Kind() {}
+
+func (*Envelope_Presence) isEnvelope_Kind() {}
+
+func (*Envelope_Heartbeat) isEnvelope_Kind() {}
+
+func (*Envelope_Resync) isEnvelope_Kind() {}
+
 type Register struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Network       string                 `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
@@ -270,11 +412,16 @@ func (x *Deregister) GetSrv6Endpoint() string {
 }
 
 type Route struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Network       string                 `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
-	Srv6Endpoint  string                 `protobuf:"bytes,2,opt,name=srv6_endpoint,json=srv6Endpoint,proto3" json:"srv6_endpoint,omitempty"`
-	Srv6Segments  []string               `protobuf:"bytes,3,rep,name=srv6_segments,json=srv6Segments,proto3" json:"srv6_segments,omitempty"`
-	Status        Route_Status           `protobuf:"varint,4,opt,name=status,proto3,enum=remote.v1.Route_Status" json:"status,omitempty"`
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Network      string                 `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	Srv6Endpoint string                 `protobuf:"bytes,2,opt,name=srv6_endpoint,json=srv6Endpoint,proto3" json:"srv6_endpoint,omitempty"`
+	Srv6Segments []string               `protobuf:"bytes,3,rep,name=srv6_segments,json=srv6Segments,proto3" json:"srv6_segments,omitempty"`
+	Status       Route_Status           `protobuf:"varint,4,opt,name=status,proto3,enum=remote.v1.Route_Status" json:"status,omitempty"`
+	// Issued by the controller, increasing with every change of the route
+	// for (srv6_endpoint, network). Updates with a version not above the last
+	// applied one are duplicates or out of order and dropped. 0 is unversioned
+	// and always applied.
+	Version       uint64 `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -337,17 +484,428 @@ func (x *Route) GetStatus() Route_Status {
 	return Route_ADD
 }
 
+func (x *Route) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+// Sent by the node on every (re)connect, after re-announcing its
+// registrations, to request the full route table for its endpoints.
+type SyncRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Srv6Endpoints []string               `protobuf:"bytes,1,rep,name=srv6_endpoints,json=srv6Endpoints,proto3" json:"srv6_endpoints,omitempty"`
+	// Increases with every SyncRequest of a node run, echoed by the Snapshot.
+	Generation    uint64 `protobuf:"varint,2,opt,name=generation,proto3" json:"generation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncRequest) Reset() {
+	*x = SyncRequest{}
+	mi := &file_remote_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncRequest) ProtoMessage() {}
+
+func (x *SyncRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_remote_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncRequest.ProtoReflect.Descriptor instead.
+func (*SyncRequest) Descriptor() ([]byte, []int) {
+	return file_remote_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SyncRequest) GetSrv6Endpoints() []string {
+	if x != nil {
+		return x.Srv6Endpoints
+	}
+	return nil
+}
+
+func (x *SyncRequest) GetGeneration() uint64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
+// Full set of routes for the node, sent by the controller in response to a
+// SyncRequest. Replaces all previously received routes, except those changed
+// by a Route the node applied after sending the SyncRequest answered. Routes
+// listed with status DELETE only record their version, so that delayed
+// updates are dropped.
+type Snapshot struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Routes []*Route               `protobuf:"bytes,1,rep,name=routes,proto3" json:"routes,omitempty"`
+	// The generation of the SyncRequest answered, 0 stands for the last one.
+	Generation    uint64 `protobuf:"varint,2,opt,name=generation,proto3" json:"generation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_remote_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_remote_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_remote_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Snapshot) GetRoutes() []*Route {
+	if x != nil {
+		return x.Routes
+	}
+	return nil
+}
+
+func (x *Snapshot) GetGeneration() uint64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
+// Sent by the node after every attempt to apply a Route to the dataplane.
+type Ack struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Network       string                 `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	Srv6Endpoint  string                 `protobuf:"bytes,2,opt,name=srv6_endpoint,json=srv6Endpoint,proto3" json:"srv6_endpoint,omitempty"`
+	Status        Route_Status           `protobuf:"varint,3,opt,name=status,proto3,enum=remote.v1.Route_Status" json:"status,omitempty"`
+	Version       uint64                 `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	Success       bool                   `protobuf:"varint,5,opt,name=success,proto3" json:"success,omitempty"`
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	mi := &file_remote_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_remote_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_remote_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Ack) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *Ack) GetSrv6Endpoint() string {
+	if x != nil {
+		return x.Srv6Endpoint
+	}
+	return ""
+}
+
+func (x *Ack) GetStatus() Route_Status {
+	if x != nil {
+		return x.Status
+	}
+	return Route_ADD
+}
+
+func (x *Ack) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Ack) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *Ack) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Sent by the node when it connects and when it shuts down. The OFFLINE
+// presence is also the last will published by the broker if the node is
+// lost.
+type Presence struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeId        string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	Srv6Net       string                 `protobuf:"bytes,2,opt,name=srv6_net,json=srv6Net,proto3" json:"srv6_net,omitempty"`
+	Version       string                 `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	Status        Presence_Status        `protobuf:"varint,4,opt,name=status,proto3,enum=remote.v1.Presence_Status" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Presence) Reset() {
+	*x = Presence{}
+	mi := &file_remote_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Presence) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Presence) ProtoMessage() {}
+
+func (x *Presence) ProtoReflect() protoreflect.Message {
+	mi := &file_remote_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Presence.ProtoReflect.Descriptor instead.
+func (*Presence) Descriptor() ([]byte, []int) {
+	return file_remote_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Presence) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *Presence) GetSrv6Net() string {
+	if x != nil {
+		return x.Srv6Net
+	}
+	return ""
+}
+
+func (x *Presence) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Presence) GetStatus() Presence_Status {
+	if x != nil {
+		return x.Status
+	}
+	return Presence_ONLINE
+}
+
+// Sent by the node periodically while connected. A digest is the hex SHA-256
+// of the sorted, newline terminated lines "<srv6_endpoint> <network>" for
+// registrations and "<srv6_endpoint> <network> <srv6_segments,...>" for the
+// egress routes installed in the dataplane. Addresses are in canonical form,
+// RFC 5952 for IPv6 and keeping the address bits of networks as received. A
+// controller whose own digest differs should send the node a Resync.
+type Heartbeat struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	NodeId              string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	Registrations       uint32                 `protobuf:"varint,2,opt,name=registrations,proto3" json:"registrations,omitempty"`
+	RegistrationsDigest string                 `protobuf:"bytes,3,opt,name=registrations_digest,json=registrationsDigest,proto3" json:"registrations_digest,omitempty"`
+	EgressRoutes        uint32                 `protobuf:"varint,4,opt,name=egress_routes,json=egressRoutes,proto3" json:"egress_routes,omitempty"`
+	EgressRoutesDigest  string                 `protobuf:"bytes,5,opt,name=egress_routes_digest,json=egressRoutesDigest,proto3" json:"egress_routes_digest,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *Heartbeat) Reset() {
+	*x = Heartbeat{}
+	mi := &file_remote_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Heartbeat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Heartbeat) ProtoMessage() {}
+
+func (x *Heartbeat) ProtoReflect() protoreflect.Message {
+	mi := &file_remote_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Heartbeat.ProtoReflect.Descriptor instead.
+func (*Heartbeat) Descriptor() ([]byte, []int) {
+	return file_remote_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Heartbeat) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *Heartbeat) GetRegistrations() uint32 {
+	if x != nil {
+		return x.Registrations
+	}
+	return 0
+}
+
+func (x *Heartbeat) GetRegistrationsDigest() string {
+	if x != nil {
+		return x.RegistrationsDigest
+	}
+	return ""
+}
+
+func (x *Heartbeat) GetEgressRoutes() uint32 {
+	if x != nil {
+		return x.EgressRoutes
+	}
+	return 0
+}
+
+func (x *Heartbeat) GetEgressRoutesDigest() string {
+	if x != nil {
+		return x.EgressRoutesDigest
+	}
+	return ""
+}
+
+// Sent by the controller to make a node re-announce its registrations and
+// send a SyncRequest, as on connect. Nodes ignore a Resync naming another
+// node, an empty node_id addresses every node.
+type Resync struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeId        string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Resync) Reset() {
+	*x = Resync{}
+	mi := &file_remote_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Resync) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Resync) ProtoMessage() {}
+
+func (x *Resync) ProtoReflect() protoreflect.Message {
+	mi := &file_remote_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Resync.ProtoReflect.Descriptor instead.
+func (*Resync) Descriptor() ([]byte, []int) {
+	return file_remote_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Resync) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
 var File_remote_proto protoreflect.FileDescriptor
 
 const file_remote_proto_rawDesc = "" +
 	"\n" +
-	"\fremote.proto\x12\tremote.v1\"\xa8\x01\n" +
+	"\fremote.proto\x12\tremote.v1\"\xd2\x03\n" +
 	"\bEnvelope\x121\n" +
 	"\bregister\x18\x01 \x01(\v2\x13.remote.v1.RegisterH\x00R\bregister\x127\n" +
 	"\n" +
 	"deregister\x18\x02 \x01(\v2\x15.remote.v1.DeregisterH\x00R\n" +
 	"deregister\x12(\n" +
-	"\x05route\x18\x03 \x01(\v2\x10.remote.v1.RouteH\x00R\x05routeB\x06\n" +
+	"\x05route\x18\x03 \x01(\v2\x10.remote.v1.RouteH\x00R\x05route\x12;\n" +
+	"\fsync_request\x18\x04 \x01(\v2\x16.remote.v1.SyncRequestH\x00R\vsyncRequest\x121\n" +
+	"\bsnapshot\x18\x05 \x01(\v2\x13.remote.v1.SnapshotH\x00R\bsnapshot\x12\"\n" +
+	"\x03ack\x18\x06 \x01(\v2\x0e.remote.v1.AckH\x00R\x03ack\x121\n" +
+	"\bpresence\x18\a \x01(\v2\x13.remote.v1.PresenceH\x00R\bpresence\x124\n" +
+	"\theartbeat\x18\b \x01(\v2\x14.remote.v1.HeartbeatH\x00R\theartbeat\x12+\n" +
+	"\x06resync\x18\t \x01(\v2\x11.remote.v1.ResyncH\x00R\x06resyncB\x06\n" +
 	"\x04kind\"I\n" +
 	"\bRegister\x12\x18\n" +
 	"\anetwork\x18\x01 \x01(\tR\anetwork\x12#\n" +
@@ -355,16 +913,51 @@ const file_remote_proto_rawDesc = "" +
 	"\n" +
 	"Deregister\x12\x18\n" +
 	"\anetwork\x18\x01 \x01(\tR\anetwork\x12#\n" +
-	"\rsrv6_endpoint\x18\x02 \x01(\tR\fsrv6Endpoint\"\xbb\x01\n" +
+	"\rsrv6_endpoint\x18\x02 \x01(\tR\fsrv6Endpoint\"\xd5\x01\n" +
 	"\x05Route\x12\x18\n" +
 	"\anetwork\x18\x01 \x01(\tR\anetwork\x12#\n" +
 	"\rsrv6_endpoint\x18\x02 \x01(\tR\fsrv6Endpoint\x12#\n" +
 	"\rsrv6_segments\x18\x03 \x03(\tR\fsrv6Segments\x12/\n" +
-	"\x06status\x18\x04 \x01(\x0e2\x17.remote.v1.Route.StatusR\x06status\"\x1d\n" +
+	"\x06status\x18\x04 \x01(\x0e2\x17.remote.v1.Route.StatusR\x06status\x12\x18\n" +
+	"\aversion\x18\x05 \x01(\x04R\aversion\"\x1d\n" +
 	"\x06Status\x12\a\n" +
 	"\x03ADD\x10\x00\x12\n" +
 	"\n" +
-	"\x06DELETE\x10\x01B9Z7github.com/datum-cloud/galactic-agent/api/remote;remoteb\x06proto3"
+	"\x06DELETE\x10\x01\"T\n" +
+	"\vSyncRequest\x12%\n" +
+	"\x0esrv6_endpoints\x18\x01 \x03(\tR\rsrv6Endpoints\x12\x1e\n" +
+	"\n" +
+	"generation\x18\x02 \x01(\x04R\n" +
+	"generation\"T\n" +
+	"\bSnapshot\x12(\n" +
+	"\x06routes\x18\x01 \x03(\v2\x10.remote.v1.RouteR\x06routes\x12\x1e\n" +
+	"\n" +
+	"generation\x18\x02 \x01(\x04R\n" +
+	"generation\"\xbf\x01\n" +
+	"\x03Ack\x12\x18\n" +
+	"\anetwork\x18\x01 \x01(\tR\anetwork\x12#\n" +
+	"\rsrv6_endpoint\x18\x02 \x01(\tR\fsrv6Endpoint\x12/\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x17.remote.v1.Route.StatusR\x06status\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x04R\aversion\x12\x18\n" +
+	"\asuccess\x18\x05 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\"\xaf\x01\n" +
+	"\bPresence\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12\x19\n" +
+	"\bsrv6_net\x18\x02 \x01(\tR\asrv6Net\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\tR\aversion\x122\n" +
+	"\x06status\x18\x04 \x01(\x0e2\x1a.remote.v1.Presence.StatusR\x06status\"!\n" +
+	"\x06Status\x12\n" +
+	"\n" +
+	"\x06ONLINE\x10\x00\x12\v\n" +
+	"\aOFFLINE\x10\x01\"\xd4\x01\n" +
+	"\tHeartbeat\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12$\n" +
+	"\rregistrations\x18\x02 \x01(\rR\rregistrations\x121\n" +
+	"\x14registrations_digest\x18\x03 \x01(\tR\x13registrationsDigest\x12#\n" +
+	"\regress_routes\x18\x04 \x01(\rR\fegressRoutes\x120\n" +
+	"\x14egress_routes_digest\x18\x05 \x01(\tR\x12egressRoutesDigest\"!\n" +
+	"\x06Resync\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeIdB9Z7github.com/datum-cloud/galactic-agent/api/remote;remoteb\x06proto3"
 
 var (
 	file_remote_proto_rawDescOnce sync.Once
@@ -378,25 +971,41 @@ func file_remote_proto_rawDescGZIP() []byte {
 	return file_remote_proto_rawDescData
 }
 
-var file_remote_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_remote_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_remote_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_remote_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_remote_proto_goTypes = []any{
-	(Route_Status)(0),  // 0: remote.v1.Route.Status
-	(*Envelope)(nil),   // 1: remote.v1.Envelope
-	(*Register)(nil),   // 2: remote.v1.Register
-	(*Deregister)(nil), // 3: remote.v1.Deregister
-	(*Route)(nil),      // 4: remote.v1.Route
+	(Route_Status)(0),    // 0: remote.v1.Route.Status
+	(Presence_Status)(0), // 1: remote.v1.Presence.Status
+	(*Envelope)(nil),     // 2: remote.v1.Envelope
+	(*Register)(nil),     // 3: remote.v1.Register
+	(*Deregister)(nil),   // 4: remote.v1.Deregister
+	(*Route)(nil),        // 5: remote.v1.Route
+	(*SyncRequest)(nil),  // 6: remote.v1.SyncRequest
+	(*Snapshot)(nil),     // 7: remote.v1.Snapshot
+	(*Ack)(nil),          // 8: remote.v1.Ack
+	(*Presence)(nil),     // 9: remote.v1.Presence
+	(*Heartbeat)(nil),    // 10: remote.v1.Heartbeat
+	(*Resync)(nil),       // 11: remote.v1.Resync
 }
 var file_remote_proto_depIdxs = []int32{
-	2, // 0: remote.v1.Envelope.register:type_name -> remote.v1.Register
-	3, // 1: remote.v1.Envelope.deregister:type_name -> remote.v1.Deregister
-	4, // 2: remote.v1.Envelope.route:type_name -> remote.v1.Route
-	0, // 3: remote.v1.Route.status:type_name -> remote.v1.Route.Status
-	4, // [4:4] is the sub-list for method output_type
-	4, // [4:4] is the sub-list for method input_type
-	4, // [4:4] is the sub-list for extension type_name
-	4, // [4:4] is the sub-list for extension extendee
-	0, // [0:4] is the sub-list for field type_name
+	3,  // 0: remote.v1.Envelope.register:type_name -> remote.v1.Register
+	4,  // 1: remote.v1.Envelope.deregister:type_name -> remote.v1.Deregister
+	5,  // 2: remote.v1.Envelope.route:type_name -> remote.v1.Route
+	6,  // 3: remote.v1.Envelope.sync_request:type_name -> remote.v1.SyncRequest
+	7,  // 4: remote.v1.Envelope.snapshot:type_name -> remote.v1.Snapshot
+	8,  // 5: remote.v1.Envelope.ack:type_name -> remote.v1.Ack
+	9,  // 6: remote.v1.Envelope.presence:type_name -> remote.v1.Presence
+	10, // 7: remote.v1.Envelope.heartbeat:type_name -> remote.v1.Heartbeat
+	11, // 8: remote.v1.Envelope.resync:type_name -> remote.v1.Resync
+	0,  // 9: remote.v1.Route.status:type_name -> remote.v1.Route.Status
+	5,  // 10: remote.v1.Snapshot.routes:type_name -> remote.v1.Route
+	0,  // 11: remote.v1.Ack.status:type_name -> remote.v1.Route.Status
+	1,  // 12: remote.v1.Presence.status:type_name -> remote.v1.Presence.Status
+	13, // [13:13] is the sub-list for method output_type
+	13, // [13:13] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_remote_proto_init() }
@@ -408,14 +1017,20 @@ func file_remote_proto_init() {
 		(*Envelope_Register)(nil),
 		(*Envelope_Deregister)(nil),
 		(*Envelope_Route)(nil),
+		(*Envelope_SyncRequest)(nil),
+		(*Envelope_Snapshot)(nil),
+		(*Envelope_Ack)(nil),
+		(*Envelope_Presence)(nil),
+		(*Envelope_Heartbeat)(nil),
+		(*Envelope_Resync)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_remote_proto_rawDesc), len(file_remote_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   4,
+			NumEnums:      2,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,109 @@
+package remote_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/datum-cloud/galactic-agent/api/remote"
+)
+
+// writeCert writes a self-signed certificate and its key as PEM files.
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSFilesErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "client")
+	badCA := filepath.Join(dir, "bad-ca.crt")
+	if err := os.WriteFile(badCA, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		files remote.TLSFiles
+	}{
+		{"CertWithoutKey", remote.TLSFiles{CertFile: certFile}},
+		{"KeyWithoutCert", remote.TLSFiles{KeyFile: keyFile}},
+		{"BadCA", remote.TLSFiles{CAFile: badCA}},
+		{"MissingCA", remote.TLSFiles{CAFile: filepath.Join(dir, "missing.crt")}},
+		{"KeyMismatch", remote.TLSFiles{CertFile: certFile, KeyFile: badCA}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.files.Config(); err == nil {
+				t.Errorf("Config() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestTLSFilesReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "before")
+	files := remote.TLSFiles{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}
+
+	subject := func() string {
+		t.Helper()
+		config, err := files.Config()
+		if err != nil {
+			t.Fatalf("Config() error = %v", err)
+		}
+		if len(config.Certificates) != 1 {
+			t.Fatalf("Config() got %d certificates, want 1", len(config.Certificates))
+		}
+		cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatalf("ParseCertificate() error = %v", err)
+		}
+		return cert.Subject.CommonName
+	}
+	if got := subject(); got != "before" {
+		t.Errorf("client certificate = %s, want before", got)
+	}
+
+	// rotated on disk, e.g. by cert-manager
+	writeCert(t, dir, "after")
+	if got := subject(); got != "after" {
+		t.Errorf("client certificate after rotation = %s, want after", got)
+	}
+}
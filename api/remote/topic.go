@@ -0,0 +1,70 @@
+package remote
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Placeholders expanded in configured topics.
+const (
+	TopicNode = "{node}"
+	TopicVPC  = "{vpc}"
+)
+
+// ExpandTopic replaces the placeholders of a topic template.
+func ExpandTopic(template, node, vpc string) string {
+	return strings.NewReplacer(TopicNode, node, TopicVPC, vpc).Replace(template)
+}
+
+// Subscriber is implemented by transports that can receive from additional
+// topics at runtime. Subscriptions are kept across reconnects.
+type Subscriber interface {
+	Subscribe(topic string) error
+	Unsubscribe(topic string) error
+}
+
+// topicSet holds the topics added with Subscribe by a transport.
+type topicSet struct {
+	// mu is held while (re)subscribing so that topics added meanwhile are
+	// not missed
+	mu     sync.Mutex
+	topics map[string]struct{}
+}
+
+// add records topic and subscribes to it with subscribe, which is a no-op
+// while disconnected.
+func (s *topicSet) add(topic string, subscribe func(string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.topics == nil {
+		s.topics = make(map[string]struct{})
+	}
+	s.topics[topic] = struct{}{}
+	return subscribe(topic)
+}
+
+// remove forgets topic and unsubscribes from it with unsubscribe, which is a
+// no-op while disconnected.
+func (s *topicSet) remove(topic string, unsubscribe func(string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.topics, topic)
+	return unsubscribe(topic)
+}
+
+// resubscribe subscribes to rx and all recorded topics with subscribe on
+// (re)connect.
+func (s *topicSet) resubscribe(rx string, subscribe func([]string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return subscribe(append([]string{rx}, slices.Sorted(maps.Keys(s.topics))...))
+}
+
+// list returns the recorded topics, sorted.
+func (s *topicSet) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.topics))
+}
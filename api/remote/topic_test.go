@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandTopic(t *testing.T) {
+	got := ExpandTopic("galactic/node/{node}/vpc/{vpc}", "node-1", "0000000004d2")
+	if want := "galactic/node/node-1/vpc/0000000004d2"; got != want {
+		t.Errorf("ExpandTopic() = %q, want %q", got, want)
+	}
+}
+
+func TestTopicSet(t *testing.T) {
+	var s topicSet
+	var subscribed []string
+	subscribe := func(topic string) error {
+		subscribed = append(subscribed, topic)
+		return nil
+	}
+	for _, topic := range []string{"b", "a", "c"} {
+		if err := s.add(topic, subscribe); err != nil {
+			t.Fatalf("add() error = %v", err)
+		}
+	}
+	if err := s.remove("c", func(string) error { return nil }); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	if want := []string{"b", "a", "c"}; !slices.Equal(subscribed, want) {
+		t.Errorf("subscribed %v, want %v", subscribed, want)
+	}
+
+	// on reconnect the receive topic comes first, then the kept topics
+	var got []string
+	if err := s.resubscribe("rx", func(topics []string) error {
+		got = topics
+		return nil
+	}); err != nil {
+		t.Fatalf("resubscribe() error = %v", err)
+	}
+	if want := []string{"rx", "a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("resubscribe() topics = %v, want %v", got, want)
+	}
+	if want := []string{"a", "b"}; !slices.Equal(s.list(), want) {
+		t.Errorf("list() = %v, want %v", s.list(), want)
+	}
+}
@@ -0,0 +1,110 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+var ErrNotConnected = errors.New("not connected")
+
+// Transport carries envelopes between the agent and the controller.
+type Transport interface {
+	// Run connects and blocks until ctx is done. receive is called for every
+	// inbound message and connected after every (re)connect once inbound
+	// messages are subscribed.
+	Run(ctx context.Context, receive func([]byte), connected func()) error
+	// Send publishes payload, failing if it was not accepted by the broker.
+	Send(payload []byte) error
+	Connected() bool
+}
+
+// LastWill is implemented by transports whose broker publishes a payload on
+// behalf of the agent when its connection is lost.
+type LastWill interface {
+	// SetLastWill must be called before Run.
+	SetLastWill(payload []byte)
+}
+
+// Memory is an in-process Transport for tests. Payloads passed to Deliver
+// are handed to the receive callback and sent payloads are recorded without
+// bound, so it must not be used by the agent binary.
+type Memory struct {
+	mu      sync.Mutex
+	receive func([]byte)
+	sent    [][]byte
+	will    []byte
+	topics  topicSet
+}
+
+func (m *Memory) Run(ctx context.Context, receive func([]byte), connected func()) error {
+	m.mu.Lock()
+	m.receive = receive
+	m.mu.Unlock()
+	connected()
+
+	<-ctx.Done()
+	m.mu.Lock()
+	m.receive = nil
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Send(payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.receive == nil {
+		return ErrNotConnected
+	}
+	m.sent = append(m.sent, slices.Clone(payload))
+	return nil
+}
+
+func (m *Memory) Connected() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.receive != nil
+}
+
+func (m *Memory) Deliver(payload []byte) error {
+	m.mu.Lock()
+	receive := m.receive
+	m.mu.Unlock()
+	if receive == nil {
+		return ErrNotConnected
+	}
+	receive(payload)
+	return nil
+}
+
+func (m *Memory) SetLastWill(payload []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.will = slices.Clone(payload)
+}
+
+func (m *Memory) LastWill() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.will)
+}
+
+func (m *Memory) Sent() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.sent)
+}
+
+func (m *Memory) Subscribe(topic string) error {
+	return m.topics.add(topic, func(string) error { return nil })
+}
+
+func (m *Memory) Unsubscribe(topic string) error {
+	return m.topics.remove(topic, func(string) error { return nil })
+}
+
+// Topics returns the topics added with Subscribe, sorted.
+func (m *Memory) Topics() []string {
+	return m.topics.list()
+}
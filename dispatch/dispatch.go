@@ -0,0 +1,170 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/datum-cloud/galactic-agent/metrics"
+)
+
+const (
+	DefaultWorkers   = 8
+	DefaultQueueSize = 64
+)
+
+var ErrStopped = errors.New("dispatcher stopped")
+
+type op struct {
+	fn     func() error
+	result chan error
+}
+
+// Dispatcher runs operations on a bounded pool of workers. Operations with
+// the same key are run one at a time in the order they were submitted,
+// operations with different keys may run in parallel.
+//
+// Keys are hashed to a worker, each with its own queue of QueueSize
+// operations. Do blocks while that queue is full.
+type Dispatcher struct {
+	Workers   int
+	QueueSize int
+
+	initOnce sync.Once
+	queues   []chan op
+	depth    []prometheus.Gauge
+	done     chan struct{}
+	// allMu keeps the workers parked by concurrent DoAll calls in the
+	// same order on every queue
+	allMu sync.Mutex
+}
+
+func (d *Dispatcher) init() {
+	d.initOnce.Do(func() {
+		workers := d.Workers
+		if workers <= 0 {
+			workers = DefaultWorkers
+		}
+		size := d.QueueSize
+		if size <= 0 {
+			size = DefaultQueueSize
+		}
+		d.queues = make([]chan op, workers)
+		d.depth = make([]prometheus.Gauge, workers)
+		for i := range d.queues {
+			d.queues[i] = make(chan op, size)
+			d.depth[i] = metrics.DispatchQueueDepth.WithLabelValues(strconv.Itoa(i))
+		}
+		d.done = make(chan struct{})
+	})
+}
+
+// Run processes operations until ctx is done. Operations still queued then
+// fail with ErrStopped.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	d.init()
+	var wg sync.WaitGroup
+	for i := range d.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx, i)
+		}()
+	}
+	wg.Wait()
+	close(d.done)
+	return nil
+}
+
+func (d *Dispatcher) work(ctx context.Context, i int) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case o := <-d.queues[i]:
+			d.depth[i].Dec()
+			o.result <- o.fn()
+		}
+	}
+}
+
+func (d *Dispatcher) submit(ctx context.Context, i int, fn func() error) (chan error, error) {
+	o := op{fn: fn, result: make(chan error, 1)}
+	d.depth[i].Inc()
+	select {
+	case d.queues[i] <- o:
+		return o.result, nil
+	case <-ctx.Done():
+		d.depth[i].Dec()
+		return nil, ctx.Err()
+	case <-d.done:
+		d.depth[i].Dec()
+		return nil, ErrStopped
+	}
+}
+
+// wait returns the error of a submitted operation. Workers only stop between
+// operations, so once the dispatcher is stopped the result is either there
+// or will never be.
+func (d *Dispatcher) wait(result chan error) error {
+	select {
+	case err := <-result:
+		return err
+	case <-d.done:
+		select {
+		case err := <-result:
+			return err
+		default:
+			return ErrStopped
+		}
+	}
+}
+
+// Do runs fn after all operations previously submitted for key and returns
+// its error. ctx only bounds the wait for a free queue slot, once queued fn
+// runs unless the dispatcher stops first.
+func (d *Dispatcher) Do(ctx context.Context, key string, fn func() error) error {
+	d.init()
+	h := fnv.New32a()
+	h.Write([]byte(key)) //nolint:errcheck
+	result, err := d.submit(ctx, int(h.Sum32()%uint32(len(d.queues))), fn)
+	if err != nil {
+		return err
+	}
+	return d.wait(result)
+}
+
+// DoAll runs fn once every operation submitted before it has completed,
+// while no other operation runs, e.g. to replace the whole state.
+func (d *Dispatcher) DoAll(ctx context.Context, fn func() error) error {
+	d.init()
+	arrived := make(chan struct{}, len(d.queues))
+	release := make(chan struct{})
+	defer close(release)
+
+	// park every worker, fn runs once all of them are parked
+	d.allMu.Lock()
+	for i := range d.queues {
+		if _, err := d.submit(ctx, i, func() error {
+			arrived <- struct{}{}
+			<-release
+			return nil
+		}); err != nil {
+			d.allMu.Unlock()
+			return err
+		}
+	}
+	d.allMu.Unlock()
+	for range d.queues {
+		select {
+		case <-arrived:
+		case <-d.done:
+			return ErrStopped
+		}
+	}
+	return fn()
+}
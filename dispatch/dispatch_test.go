@@ -0,0 +1,138 @@
+package dispatch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/datum-cloud/galactic-agent/dispatch"
+)
+
+func start(t *testing.T, d *dispatch.Dispatcher) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}
+}
+
+func TestDoSerializesKey(t *testing.T) {
+	d := &dispatch.Dispatcher{Workers: 4}
+	stop := start(t, d)
+	defer stop()
+
+	var (
+		running atomic.Int32
+		wg      sync.WaitGroup
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := d.Do(context.Background(), "10.0.0.0/24", func() error {
+				if running.Add(1) != 1 {
+					t.Errorf("operations for the same key overlap")
+				}
+				time.Sleep(100 * time.Microsecond)
+				running.Add(-1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDoParallelKeys(t *testing.T) {
+	d := &dispatch.Dispatcher{Workers: 16}
+	stop := start(t, d)
+	defer stop()
+
+	// both operations only return once the other one is running
+	started := make(chan struct{}, 2)
+	var wg sync.WaitGroup
+	for _, key := range []string{"fc00::1/10.0.0.0/24", "fc00::2/10.1.0.0/24"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := d.Do(context.Background(), key, func() error {
+				started <- struct{}{}
+				deadline := time.After(5 * time.Second)
+				for len(started) < 2 {
+					select {
+					case <-deadline:
+						return errors.New("timed out waiting for the other key")
+					case <-time.After(time.Millisecond):
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Do(%s) error = %v", key, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDoAll(t *testing.T) {
+	d := &dispatch.Dispatcher{Workers: 4}
+	stop := start(t, d)
+	defer stop()
+
+	var running atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := d.Do(context.Background(), fmt.Sprint(i), func() error {
+				running.Add(1)
+				time.Sleep(time.Millisecond)
+				running.Add(-1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+		}()
+	}
+	want := errors.New("snapshot")
+	err := d.DoAll(context.Background(), func() error {
+		if n := running.Load(); n != 0 {
+			t.Errorf("DoAll() ran with %d operations running", n)
+		}
+		return want
+	})
+	if !errors.Is(err, want) {
+		t.Errorf("DoAll() error = %v, want %v", err, want)
+	}
+	wg.Wait()
+}
+
+func TestDoStopped(t *testing.T) {
+	d := &dispatch.Dispatcher{}
+	stop := start(t, d)
+	stop()
+
+	err := d.Do(context.Background(), "key", func() error {
+		t.Errorf("operation ran after stop")
+		return nil
+	})
+	if !errors.Is(err, dispatch.ErrStopped) {
+		t.Errorf("Do() error = %v, want %v", err, dispatch.ErrStopped)
+	}
+}
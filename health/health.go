@@ -0,0 +1,60 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type check struct {
+	name string
+	fn   func() error
+}
+
+// Health serves the liveness and readiness endpoints. The agent is ready
+// once every readiness check passes.
+type Health struct {
+	mu     sync.Mutex
+	checks []check
+}
+
+func (h *Health) AddReadinessCheck(name string, fn func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check{name: name, fn: fn})
+}
+
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok") //nolint:errcheck
+	})
+}
+
+// ReadinessHandler reports the result of every check, answering 503 if any
+// of them fails.
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		h.mu.Lock()
+		checks := h.checks
+		h.mu.Unlock()
+
+		var b strings.Builder
+		ready := true
+		for _, c := range checks {
+			if err := c.fn(); err != nil {
+				ready = false
+				fmt.Fprintf(&b, "[-]%s failed: %v\n", c.name, err)
+			} else {
+				fmt.Fprintf(&b, "[+]%s ok\n", c.name)
+			}
+		}
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			b.WriteString("readyz check failed\n")
+		} else {
+			b.WriteString("readyz check passed\n")
+		}
+		w.Write([]byte(b.String())) //nolint:errcheck
+	})
+}
@@ -5,30 +5,72 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strconv"
 	"syscall"
-
-	"golang.org/x/sync/errgroup"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/vishvananda/netlink"
 
-	"google.golang.org/protobuf/proto"
-
+	"github.com/datum-cloud/galactic-agent/agent"
 	"github.com/datum-cloud/galactic-agent/api/local"
 	"github.com/datum-cloud/galactic-agent/api/remote"
+	"github.com/datum-cloud/galactic-agent/dispatch"
 	"github.com/datum-cloud/galactic-agent/srv6"
-	"github.com/datum-cloud/galactic-common/util"
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
 )
 
 var configFile string
 
+// version can be set at build time with -ldflags "-X main.version=...",
+// otherwise the module version stamped from the git checkout is used: the
+// tag of a release or a pseudo-version naming the commit.
+var version = "dev"
+
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
 func initConfig() {
+	hostname, _ := os.Hostname()
+	viper.SetDefault("node_name", hostname)
 	viper.SetDefault("srv6_net", "fc00::/56")
 	viper.SetDefault("socket_path", "/var/run/galactic/agent.sock")
+	viper.SetDefault("socket_mode", "0660")
+	viper.SetDefault("socket_uid", -1)
+	viper.SetDefault("socket_gid", -1)
+	viper.SetDefault("store_path", "/var/run/galactic/registrations.json")
+	// kept across reboots, unlike /var/run
+	viper.SetDefault("checkpoint_path", "/var/lib/galactic/routes.json")
+	viper.SetDefault("http_address", ":9437")
+	viper.SetDefault("transport", "mqtt")
+	viper.SetDefault("queue_size", remote.DefaultQueueSize)
+	viper.SetDefault("dispatch_workers", dispatch.DefaultWorkers)
+	viper.SetDefault("dispatch_queue_size", dispatch.DefaultQueueSize)
 	viper.SetDefault("mqtt_url", "tcp://mqtt:1883")
 	viper.SetDefault("mqtt_qos", 1)
+	viper.SetDefault("mqtt_message_expiry", 5*time.Minute)
+	// shared by every node, controllers addressing nodes individually are
+	// opted into with e.g. "galactic/default/node/{node}/receive" and
+	// mqtt_topic_vpc "galactic/default/vpc/{vpc}/routes"
 	viper.SetDefault("mqtt_topic_receive", "galactic/default/receive")
 	viper.SetDefault("mqtt_topic_send", "galactic/default/send")
+	viper.SetDefault("nats_url", "nats://nats:4222")
+	viper.SetDefault("nats_subject_receive", "galactic.default.receive")
+	viper.SetDefault("nats_subject_send", "galactic.default.send")
+	viper.SetDefault("heartbeat_interval", agent.DefaultHeartbeatInterval)
+	viper.SetDefault("reconcile_interval", srv6.DefaultReconcileInterval)
+	viper.SetDefault("stale_grace_period", srv6.DefaultGracePeriod)
+	viper.SetDefault("pending_route_ttl", srv6.DefaultPendingTTL)
+	viper.SetDefault("route_protocol", int(srv6.DefaultProtocol))
 	if configFile != "" {
 		viper.SetConfigFile(configFile)
 	}
@@ -40,11 +82,6 @@ func initConfig() {
 	}
 }
 
-var (
-	l local.Local
-	r remote.Remote
-)
-
 func main() {
 	cmd := &cobra.Command{
 		Use:   "galactic-agent",
@@ -56,107 +93,108 @@ func main() {
 			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 			defer stop() //nolint:errcheck
 
-			_, err := util.EncodeSRv6Endpoint(viper.GetString("srv6_net"), "ffffffffffff", "ffff")
+			protocol := viper.GetInt("route_protocol")
+			if protocol < 0 || protocol > 255 {
+				log.Fatalf("route_protocol invalid: %d", protocol)
+			}
+			socketMode, err := strconv.ParseUint(viper.GetString("socket_mode"), 8, 32)
 			if err != nil {
-				log.Fatalf("srv6_endpoint invalid: %v", err)
+				log.Fatalf("socket_mode invalid: %v", err)
 			}
-
-			l = local.Local{
-				SocketPath: viper.GetString("socket_path"),
-				RegisterHandler: func(vpc, vpcAttachment string, networks []string) error {
-					srv6_endpoint, err := util.EncodeSRv6Endpoint(viper.GetString("srv6_net"), vpc, vpcAttachment)
-					if err != nil {
-						return err
-					}
-					if err := srv6.RouteIngressAdd(srv6_endpoint); err != nil {
-						return err
-					}
-					for _, n := range networks {
-						log.Printf("REGISTER: network='%s', srv6_endpoint='%s'", n, srv6_endpoint)
-						payload, err := proto.Marshal(&remote.Envelope{
-							Kind: &remote.Envelope_Register{
-								Register: &remote.Register{
-									Network:      n,
-									Srv6Endpoint: srv6_endpoint,
-								},
-							},
-						})
-						if err != nil {
-							return err
-						}
-						r.Send(payload)
-					}
-					return nil
-				},
-				DeregisterHandler: func(vpc, vpcAttachment string, networks []string) error {
-					srv6_endpoint, err := util.EncodeSRv6Endpoint(viper.GetString("srv6_net"), vpc, vpcAttachment)
-					if err != nil {
-						return err
-					}
-					if err := srv6.RouteIngressDel(srv6_endpoint); err != nil {
-						return err
-					}
-					for _, n := range networks {
-						log.Printf("DEREGISTER: network='%s', srv6_endpoint='%s'", n, srv6_endpoint)
-						payload, err := proto.Marshal(&remote.Envelope{
-							Kind: &remote.Envelope_Deregister{
-								Deregister: &remote.Deregister{
-									Network:      n,
-									Srv6Endpoint: srv6_endpoint,
-								},
-							},
-						})
-						if err != nil {
-							return err
-						}
-						r.Send(payload)
-					}
-					return nil
-				},
+			var rules []local.Rule
+			if err := viper.UnmarshalKey("auth_rules", &rules); err != nil {
+				log.Fatalf("auth_rules invalid: %v", err)
 			}
 
-			r = remote.Remote{
-				URL:      viper.GetString("mqtt_url"),
-				ClientID: viper.GetString("mqtt_clientid"),
-				Username: viper.GetString("mqtt_username"),
-				Password: viper.GetString("mqtt_password"),
-				QoS:      byte(viper.GetInt("mqtt_qos")),
-				TopicRX:  viper.GetString("mqtt_topic_receive"),
-				TopicTX:  viper.GetString("mqtt_topic_send"),
-				ReceiveHandler: func(payload []byte) error {
-					envelope := &remote.Envelope{}
-					if err := proto.Unmarshal(payload, envelope); err != nil {
-						return err
-					}
-					switch kind := envelope.Kind.(type) {
-					case *remote.Envelope_Route:
-						log.Printf("ROUTE: status='%s', network='%s', srv6_endpoint='%s', srv6_segments='%s'", kind.Route.Status, kind.Route.Network, kind.Route.Srv6Endpoint, kind.Route.Srv6Segments)
-						switch kind.Route.Status {
-						case remote.Route_ADD:
-							if err := srv6.RouteEgressAdd(kind.Route.Network, kind.Route.Srv6Endpoint, kind.Route.Srv6Segments); err != nil {
-								return err
-							}
-						case remote.Route_DELETE:
-							if err := srv6.RouteEgressDel(kind.Route.Network, kind.Route.Srv6Endpoint, kind.Route.Srv6Segments); err != nil {
-								return err
-							}
-						}
-					}
-					return nil
-				},
+			var tlsFiles *remote.TLSFiles
+			if viper.GetString("mqtt_tls_ca_file") != "" || viper.GetString("mqtt_tls_cert_file") != "" ||
+				viper.GetString("mqtt_tls_key_file") != "" || viper.GetString("mqtt_tls_server_name") != "" ||
+				viper.GetBool("mqtt_tls_insecure_skip_verify") {
+				tlsFiles = &remote.TLSFiles{
+					CAFile:             viper.GetString("mqtt_tls_ca_file"),
+					CertFile:           viper.GetString("mqtt_tls_cert_file"),
+					KeyFile:            viper.GetString("mqtt_tls_key_file"),
+					ServerName:         viper.GetString("mqtt_tls_server_name"),
+					InsecureSkipVerify: viper.GetBool("mqtt_tls_insecure_skip_verify"),
+				}
+			}
+			// {node} is expanded here, {vpc} by the agent per attached VPC
+			topic := func(key string) string {
+				return remote.ExpandTopic(viper.GetString(key), viper.GetString("node_name"), remote.TopicVPC)
+			}
+			var vpcTopic string
+			var transport remote.Transport
+			switch viper.GetString("transport") {
+			case "mqtt":
+				transport = &remote.MQTT{
+					URL:      viper.GetString("mqtt_url"),
+					ClientID: viper.GetString("mqtt_clientid"),
+					Username: viper.GetString("mqtt_username"),
+					Password: viper.GetString("mqtt_password"),
+					QoS:      byte(viper.GetInt("mqtt_qos")),
+					TopicRX:  topic("mqtt_topic_receive"),
+					TopicTX:  topic("mqtt_topic_send"),
+					TLS:      tlsFiles,
+				}
+				vpcTopic = topic("mqtt_topic_vpc")
+			case "mqttv5":
+				transport = &remote.MQTTv5{
+					URL:           viper.GetString("mqtt_url"),
+					ClientID:      viper.GetString("mqtt_clientid"),
+					Username:      viper.GetString("mqtt_username"),
+					Password:      viper.GetString("mqtt_password"),
+					QoS:           byte(viper.GetInt("mqtt_qos")),
+					TopicRX:       topic("mqtt_topic_receive"),
+					TopicTX:       topic("mqtt_topic_send"),
+					TLS:           tlsFiles,
+					NodeID:        viper.GetString("node_name"),
+					MessageExpiry: viper.GetDuration("mqtt_message_expiry"),
+					ResponseTopic: topic("mqtt_response_topic"),
+				}
+				vpcTopic = topic("mqtt_topic_vpc")
+			case "nats":
+				transport = &remote.NATS{
+					URL:       viper.GetString("nats_url"),
+					Name:      viper.GetString("nats_name"),
+					Username:  viper.GetString("nats_username"),
+					Password:  viper.GetString("nats_password"),
+					Token:     viper.GetString("nats_token"),
+					SubjectRX: viper.GetString("nats_subject_receive"),
+					SubjectTX: viper.GetString("nats_subject_send"),
+				}
+			default:
+				log.Fatalf("transport invalid: %s", viper.GetString("transport"))
 			}
 
-			g, ctx := errgroup.WithContext(ctx)
-			g.Go(func() error {
-				return l.Serve(ctx)
-			})
-			g.Go(func() error {
-				return r.Run(ctx)
-			})
-			if err := g.Wait(); err != nil {
+			a, err := agent.New(agent.Config{
+				NodeID:            viper.GetString("node_name"),
+				Version:           buildVersion(),
+				SRv6Net:           viper.GetString("srv6_net"),
+				SocketPath:        viper.GetString("socket_path"),
+				SocketMode:        os.FileMode(socketMode),
+				SocketUID:         viper.GetInt("socket_uid"),
+				SocketGID:         viper.GetInt("socket_gid"),
+				AuthRules:         rules,
+				StorePath:         viper.GetString("store_path"),
+				CheckpointPath:    viper.GetString("checkpoint_path"),
+				HTTPAddress:       viper.GetString("http_address"),
+				VPCTopic:          vpcTopic,
+				QueueSize:         viper.GetInt("queue_size"),
+				QueueDir:          viper.GetString("queue_dir"),
+				DispatchWorkers:   viper.GetInt("dispatch_workers"),
+				DispatchQueueSize: viper.GetInt("dispatch_queue_size"),
+				HeartbeatInterval: viper.GetDuration("heartbeat_interval"),
+				ReconcileInterval: viper.GetDuration("reconcile_interval"),
+				StaleGracePeriod:  viper.GetDuration("stale_grace_period"),
+				PendingRouteTTL:   viper.GetDuration("pending_route_ttl"),
+				RouteProtocol:     netlink.RouteProtocol(protocol),
+			}, dataplane.Netlink{}, transport)
+			if err != nil {
+				log.Fatalf("Config invalid: %v", err)
+			}
+			if err := a.Run(ctx); err != nil {
 				log.Printf("Error: %v", err)
 			}
-			log.Printf("Shutdown")
 		},
 	}
 	cmd.PersistentFlags().StringVar(&configFile, "config", "", "config file")
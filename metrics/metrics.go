@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "galactic_agent"
+
+var (
+	GRPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "Local gRPC requests by method and status code.",
+	}, []string{"method", "code"})
+
+	GRPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Local gRPC request latency by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Envelopes received from the controller by kind.",
+	}, []string{"kind"})
+
+	MessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Envelopes queued for the controller by kind.",
+	}, []string{"kind"})
+
+	RoutesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "routes_dropped_total",
+		Help:      "Route updates from the controller dropped by reason (duplicate, out_of_order, outside_srv6_net, unknown_attachment).",
+	}, []string{"reason"})
+
+	TransportPublish = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transport_publish_total",
+		Help:      "Publish attempts on the transport by result.",
+	}, []string{"result"})
+
+	MQTTReasonCodes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_reason_codes_total",
+		Help:      "MQTT v5 reason codes received by packet (connack, suback, unsuback, puback, disconnect) and code.",
+	}, []string{"packet", "code"})
+
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "outbound_queue_depth",
+		Help:      "Payloads waiting in the outbound queue.",
+	})
+
+	DispatchQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dispatch_queue_depth",
+		Help:      "Dataplane operations waiting for a dispatch worker by worker.",
+	}, []string{"worker"})
+
+	NetlinkOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "netlink_operations_total",
+		Help:      "Netlink operations by operation and result.",
+	}, []string{"operation", "result"})
+
+	ReconcileDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of a full dataplane reconcile.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	InstalledRoutes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "installed_routes",
+		Help:      "Routes installed by the agent by kind (ingress, egress) and VRF.",
+	}, []string{"kind", "vrf"})
+
+	PendingRoutes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_routes",
+		Help:      "Egress routes waiting for their VRF or interface to appear.",
+	})
+
+	PendingRoutesExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pending_routes_expired_total",
+		Help:      "Pending egress routes dropped because their VRF or interface did not appear in time.",
+	})
+
+	connected atomic.Pointer[func() bool]
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "transport_connected",
+		Help:      "Whether the transport to the controller is connected.",
+	}, func() float64 {
+		if f := connected.Load(); f != nil && (*f)() {
+			return 1
+		}
+		return 0
+	})
+)
+
+// SetConnectedFunc sets the function reporting the transport connection
+// state for the transport_connected gauge.
+func SetConnectedFunc(f func() bool) {
+	connected.Store(&f)
+}
+
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// Server serves /metrics and any additional Handlers over HTTP.
+type Server struct {
+	Address  string
+	Handlers map[string]http.Handler
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	for pattern, handler := range s.Handlers {
+		mux.Handle(pattern, handler)
+	}
+
+	listener, err := net.Listen("tcp", s.Address)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	routineErr := make(chan error, 1)
+	go func() {
+		log.Printf("HTTP listening: %s", listener.Addr())
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			routineErr <- err
+			return
+		}
+		routineErr <- nil
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown failed: %v", err)
+	}
+	log.Println("HTTP stopped")
+	return <-routineErr
+}
@@ -0,0 +1,86 @@
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/datum-cloud/galactic-common/util"
+)
+
+var ErrLinkNotFound = errors.New("link not found")
+
+// Dataplane is the subset of netlink used to program SRv6 state.
+type Dataplane interface {
+	LinkByName(name string) (netlink.Link, error)
+	LinkList() ([]netlink.Link, error)
+	RouteReplace(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+	RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
+	NeighAdd(neigh *netlink.Neigh) error
+	NeighDel(neigh *netlink.Neigh) error
+	NeighProxyList(linkIndex, family int) ([]netlink.Neigh, error)
+	// LinkSubscribe sends link updates to ch until done is closed, then
+	// closes ch.
+	LinkSubscribe(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error
+}
+
+// Netlink programs the kernel of the current network namespace.
+type Netlink struct{}
+
+func (Netlink) LinkByName(name string) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	var notFound netlink.LinkNotFoundError
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("%w: %s", ErrLinkNotFound, name)
+	}
+	return link, err
+}
+
+func (Netlink) LinkList() ([]netlink.Link, error) {
+	return netlink.LinkList()
+}
+
+func (Netlink) RouteReplace(route *netlink.Route) error {
+	return netlink.RouteReplace(route)
+}
+
+func (Netlink) RouteDel(route *netlink.Route) error {
+	return netlink.RouteDel(route)
+}
+
+func (Netlink) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	return netlink.RouteListFiltered(family, filter, filterMask)
+}
+
+func (Netlink) NeighAdd(neigh *netlink.Neigh) error {
+	return netlink.NeighAdd(neigh)
+}
+
+func (Netlink) NeighDel(neigh *netlink.Neigh) error {
+	return netlink.NeighDel(neigh)
+}
+
+func (Netlink) NeighProxyList(linkIndex, family int) ([]netlink.Neigh, error) {
+	return netlink.NeighProxyList(linkIndex, family)
+}
+
+func (Netlink) LinkSubscribe(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
+	return netlink.LinkSubscribe(ch, done)
+}
+
+// GetVRFIdForVPC is vrf.GetVRFIdForVPC on top of a Dataplane.
+func GetVRFIdForVPC(dp Dataplane, vpc, vpcAttachment string) (uint32, error) {
+	name := util.GenerateInterfaceNameVRF(vpc, vpcAttachment)
+	links, err := dp.LinkList()
+	if err != nil {
+		return 0, err
+	}
+	for _, link := range links {
+		if vrf, ok := link.(*netlink.Vrf); ok && vrf.Name == name {
+			return vrf.Table, nil
+		}
+	}
+	return 0, fmt.Errorf("could not find VRF ID for interface: %w: %s", ErrLinkNotFound, name)
+}
@@ -0,0 +1,240 @@
+package dataplane
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Fake is an in-memory Dataplane recording links, routes and neighbors.
+// Errors set in Errs, or with SetErr once in use, are returned by the method
+// of the same name.
+type Fake struct {
+	Errs map[string]error
+
+	mu          sync.Mutex
+	links       []netlink.Link
+	routes      []netlink.Route
+	neighs      []netlink.Neigh
+	subscribers map[chan netlink.LinkUpdate]struct{}
+}
+
+func (f *Fake) err(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Errs[method]
+}
+
+// SetErr sets the error returned by method, nil clears it.
+func (f *Fake) SetErr(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Errs == nil {
+		f.Errs = make(map[string]error)
+	}
+	f.Errs[method] = err
+}
+
+// AddLink adds link, assigning it the next free index.
+func (f *Fake) AddLink(link netlink.Link) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	link.Attrs().Index = len(f.links) + 1
+	f.links = append(f.links, link)
+	update := netlink.LinkUpdate{
+		Header: unix.NlMsghdr{Type: unix.RTM_NEWLINK},
+		Link:   link,
+	}
+	for updates := range f.subscribers {
+		select {
+		case updates <- update:
+		default:
+		}
+	}
+}
+
+func (f *Fake) Routes() []netlink.Route {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.routes)
+}
+
+func (f *Fake) Neighs() []netlink.Neigh {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.neighs)
+}
+
+func (f *Fake) LinkByName(name string) (netlink.Link, error) {
+	if err := f.err("LinkByName"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, link := range f.links {
+		if link.Attrs().Name == name {
+			return link, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrLinkNotFound, name)
+}
+
+func (f *Fake) LinkList() ([]netlink.Link, error) {
+	if err := f.err("LinkList"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.links), nil
+}
+
+func table(route *netlink.Route) int {
+	if route.Table == 0 {
+		return unix.RT_TABLE_MAIN
+	}
+	return route.Table
+}
+
+func sameRoute(a, b *netlink.Route) bool {
+	return table(a) == table(b) && a.Dst.String() == b.Dst.String()
+}
+
+func (f *Fake) RouteReplace(route *netlink.Route) error {
+	if err := f.err("RouteReplace"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := *route
+	stored.Table = table(route)
+	f.routes = slices.DeleteFunc(f.routes, func(r netlink.Route) bool {
+		return sameRoute(&r, &stored)
+	})
+	f.routes = append(f.routes, stored)
+	return nil
+}
+
+func (f *Fake) RouteDel(route *netlink.Route) error {
+	if err := f.err("RouteDel"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.routes)
+	f.routes = slices.DeleteFunc(f.routes, func(r netlink.Route) bool {
+		return sameRoute(&r, route) &&
+			(route.LinkIndex == 0 || r.LinkIndex == route.LinkIndex) &&
+			(route.Protocol == 0 || r.Protocol == route.Protocol)
+	})
+	if len(f.routes) == n {
+		return unix.ESRCH
+	}
+	return nil
+}
+
+func (f *Fake) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	if err := f.err("RouteListFiltered"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var routes []netlink.Route
+	for _, r := range f.routes {
+		isV4 := r.Dst != nil && r.Dst.IP.To4() != nil
+		switch {
+		case family == netlink.FAMILY_V4 && !isV4, family == netlink.FAMILY_V6 && isV4:
+		case filterMask&netlink.RT_FILTER_TABLE == 0 && r.Table != unix.RT_TABLE_MAIN:
+		case filterMask&netlink.RT_FILTER_TABLE != 0 && r.Table != table(filter):
+		case filterMask&netlink.RT_FILTER_OIF != 0 && r.LinkIndex != filter.LinkIndex:
+		case filterMask&netlink.RT_FILTER_PROTOCOL != 0 && r.Protocol != filter.Protocol:
+		default:
+			routes = append(routes, r)
+		}
+	}
+	return routes, nil
+}
+
+func sameNeigh(a, b *netlink.Neigh) bool {
+	return a.LinkIndex == b.LinkIndex && a.IP.Equal(b.IP)
+}
+
+func (f *Fake) NeighAdd(neigh *netlink.Neigh) error {
+	if err := f.err("NeighAdd"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if slices.ContainsFunc(f.neighs, func(n netlink.Neigh) bool { return sameNeigh(&n, neigh) }) {
+		return unix.EEXIST
+	}
+	f.neighs = append(f.neighs, *neigh)
+	return nil
+}
+
+func (f *Fake) NeighDel(neigh *netlink.Neigh) error {
+	if err := f.err("NeighDel"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.neighs)
+	f.neighs = slices.DeleteFunc(f.neighs, func(n netlink.Neigh) bool { return sameNeigh(&n, neigh) })
+	if len(f.neighs) == n {
+		return unix.ENOENT
+	}
+	return nil
+}
+
+func (f *Fake) NeighProxyList(linkIndex, family int) ([]netlink.Neigh, error) {
+	if err := f.err("NeighProxyList"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var neighs []netlink.Neigh
+	for _, n := range f.neighs {
+		if n.LinkIndex == linkIndex && n.Flags&netlink.NTF_PROXY != 0 {
+			neighs = append(neighs, n)
+		}
+	}
+	return neighs, nil
+}
+
+// LinkSubscribe sends an update for every link added with AddLink. Updates
+// are dropped if the subscriber falls behind.
+func (f *Fake) LinkSubscribe(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
+	if err := f.err("LinkSubscribe"); err != nil {
+		return err
+	}
+	updates := make(chan netlink.LinkUpdate, 16)
+	f.mu.Lock()
+	if f.subscribers == nil {
+		f.subscribers = make(map[chan netlink.LinkUpdate]struct{})
+	}
+	f.subscribers[updates] = struct{}{}
+	f.mu.Unlock()
+	go func() {
+		defer close(ch)
+		defer func() {
+			f.mu.Lock()
+			delete(f.subscribers, updates)
+			f.mu.Unlock()
+		}()
+		for {
+			select {
+			case <-done:
+				return
+			case update := <-updates:
+				select {
+				case ch <- update:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
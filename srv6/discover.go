@@ -0,0 +1,110 @@
+package srv6
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
+	"github.com/datum-cloud/galactic-agent/srv6/neighborproxy"
+	"github.com/datum-cloud/galactic-agent/srv6/routeegress"
+	"github.com/datum-cloud/galactic-agent/srv6/routeingress"
+)
+
+// parseInterfaceName reverses util.InterfaceNameTemplate, returning the
+// base62 vpc and vpcattachment with the zero padding removed so they match
+// the values decoded from an SRv6 endpoint.
+func parseInterfaceName(name, suffix string) (attachment, bool) {
+	if len(name) != 14 || name[0] != 'G' || !strings.HasSuffix(name, suffix) {
+		return attachment{}, false
+	}
+	trim := func(s string) string {
+		s = strings.TrimLeft(s, "0")
+		if s == "" {
+			return "0"
+		}
+		return s
+	}
+	return attachment{vpc: trim(name[1:10]), vpcAttachment: trim(name[10:13])}, true
+}
+
+func listAttachments(dp dataplane.Dataplane, suffix string) ([]attachment, error) {
+	links, err := dp.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	var attachments []attachment
+	for _, link := range links {
+		if a, ok := parseInterfaceName(link.Attrs().Name, suffix); ok {
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments, nil
+}
+
+// discover returns the ingress SIDs and egress routes tagged with protocol
+// and the neighbor proxies currently present in the kernel on galactic
+// interfaces.
+func discover(dp dataplane.Dataplane, protocol netlink.RouteProtocol) (appliedState, error) {
+	found := appliedState{
+		ingress:   make(map[string]ingressRoute),
+		egress:    make(map[string]egressRoute),
+		neighbors: make(map[string]neighborProxy),
+	}
+	var errs []error
+
+	vrfs, err := listAttachments(dp, "V")
+	if err != nil {
+		return found, err
+	}
+	for _, a := range vrfs {
+		routes, err := routeegress.List(dp, a.vpc, a.vpcAttachment, protocol)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("routeegress list failed: %s/%s: %w", a.vpc, a.vpcAttachment, err))
+			continue
+		}
+		for _, route := range routes {
+			if route.Dst == nil {
+				continue
+			}
+			e := egressRoute{
+				vpc:           a.vpc,
+				vpcAttachment: a.vpcAttachment,
+				prefix:        route.Dst,
+				segments:      route.Encap.(*netlink.SEG6Encap).Segments,
+			}
+			found.egress[e.key()] = e
+		}
+	}
+
+	hosts, err := listAttachments(dp, "H")
+	if err != nil {
+		return found, err
+	}
+	for _, a := range hosts {
+		routes, err := routeingress.List(dp, a.vpc, a.vpcAttachment, protocol)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("routeingress list failed: %s/%s: %w", a.vpc, a.vpcAttachment, err))
+		}
+		for _, route := range routes {
+			if route.Dst == nil {
+				continue
+			}
+			in := ingressRoute{ip: route.Dst, vpc: a.vpc, vpcAttachment: a.vpcAttachment}
+			found.ingress[in.key()] = in
+		}
+
+		neighs, err := neighborproxy.List(dp, a.vpc, a.vpcAttachment)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("neighborproxy list failed: %s/%s: %w", a.vpc, a.vpcAttachment, err))
+		}
+		for _, neigh := range neighs {
+			n := neighborProxy{ip: netlink.NewIPNet(neigh.IP), vpc: a.vpc, vpcAttachment: a.vpcAttachment}
+			found.neighbors[n.key()] = n
+		}
+	}
+
+	return found, errors.Join(errs...)
+}
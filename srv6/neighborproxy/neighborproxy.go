@@ -5,12 +5,13 @@ import (
 
 	"github.com/vishvananda/netlink"
 
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
 	"github.com/datum-cloud/galactic-common/util"
 )
 
-func Add(ipnet *net.IPNet, vpc, vpcAttachment string) error {
+func Add(dp dataplane.Dataplane, ipnet *net.IPNet, vpc, vpcAttachment string) error {
 	dev := util.GenerateInterfaceNameHost(vpc, vpcAttachment)
-	link, err := netlink.LinkByName(dev)
+	link, err := dp.LinkByName(dev)
 	if err != nil {
 		return err
 	}
@@ -22,12 +23,12 @@ func Add(ipnet *net.IPNet, vpc, vpcAttachment string) error {
 		Flags:     netlink.NTF_PROXY,
 	}
 
-	return netlink.NeighAdd(neigh)
+	return dp.NeighAdd(neigh)
 }
 
-func Delete(ipnet *net.IPNet, vpc, vpcAttachment string) error {
+func Delete(dp dataplane.Dataplane, ipnet *net.IPNet, vpc, vpcAttachment string) error {
 	dev := util.GenerateInterfaceNameHost(vpc, vpcAttachment)
-	link, err := netlink.LinkByName(dev)
+	link, err := dp.LinkByName(dev)
 	if err != nil {
 		return err
 	}
@@ -39,5 +40,15 @@ func Delete(ipnet *net.IPNet, vpc, vpcAttachment string) error {
 		Flags:     netlink.NTF_PROXY,
 	}
 
-	return netlink.NeighDel(neigh)
+	return dp.NeighDel(neigh)
+}
+
+func List(dp dataplane.Dataplane, vpc, vpcAttachment string) ([]netlink.Neigh, error) {
+	dev := util.GenerateInterfaceNameHost(vpc, vpcAttachment)
+	link, err := dp.LinkByName(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	return dp.NeighProxyList(link.Attrs().Index, netlink.FAMILY_ALL)
 }
@@ -0,0 +1,510 @@
+package srv6
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+
+	"github.com/datum-cloud/galactic-agent/metrics"
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
+	"github.com/datum-cloud/galactic-agent/srv6/neighborproxy"
+	"github.com/datum-cloud/galactic-agent/srv6/routeegress"
+	"github.com/datum-cloud/galactic-agent/srv6/routeingress"
+	"github.com/datum-cloud/galactic-common/util"
+)
+
+const (
+	DefaultReconcileInterval = 30 * time.Second
+	DefaultGracePeriod       = 2 * time.Minute
+	DefaultPendingTTL        = 5 * time.Minute
+)
+
+// linkResubscribe is the delay before subscribing to link updates again
+// after the subscription failed.
+const linkResubscribe = 5 * time.Second
+
+// ErrPendingExpired is reported for an egress route whose VRF or interface,
+// or a neighbor proxy whose host interface, did not appear within the
+// PendingTTL.
+var ErrPendingExpired = errors.New("pending route expired")
+
+// DefaultProtocol is the rtm_protocol of every route installed by the agent,
+// see config/iproute2/rt_protos.d/galactic.conf.
+const DefaultProtocol netlink.RouteProtocol = 201
+
+func (r *Reconciler) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	r.mu.Lock()
+	r.init()
+	trigger := r.trigger
+	r.mu.Unlock()
+
+	r.adoptStale()
+	grace := time.NewTimer(r.GracePeriod)
+	defer grace.Stop()
+
+	linksDone := make(chan struct{})
+	go func() {
+		defer close(linksDone)
+		r.watchLinks(ctx)
+	}()
+	defer func() { <-linksDone }()
+
+	log.Printf("Reconciler started: interval=%s, grace_period=%s, protocol=%d", interval, r.GracePeriod, r.Protocol)
+	for {
+		if err := r.Reconcile(); err != nil {
+			log.Printf("Reconcile failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("Reconciler stopped")
+			return nil
+		case <-grace.C:
+			log.Println("Reconciler grace period expired, removing unconfirmed stale entries")
+		case <-ticker.C:
+		case <-trigger:
+		}
+	}
+}
+
+// watchLinks triggers a reconcile whenever a link appears while egress
+// routes or neighbor proxies are pending, so that they are installed as soon
+// as their VRF or interface exists.
+func (r *Reconciler) watchLinks(ctx context.Context) {
+	for {
+		updates := make(chan netlink.LinkUpdate)
+		done := make(chan struct{})
+		if err := r.dataplane().LinkSubscribe(updates, done); err != nil {
+			log.Printf("Link subscribe failed: %v", err)
+		} else {
+			for open := true; open; {
+				select {
+				case <-ctx.Done():
+					close(done)
+					for range updates {
+					}
+					return
+				case update, ok := <-updates:
+					open = ok
+					if ok && update.Header.Type == unix.RTM_NEWLINK && r.pendingCount.Load() > 0 {
+						r.Trigger()
+					}
+				}
+			}
+			close(done)
+			log.Println("Link subscription closed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(linkResubscribe):
+		}
+	}
+}
+
+// adoptStale takes over the entries left in the kernel by a previous run and
+// marks them stale until the grace period expires.
+func (r *Reconciler) adoptStale() {
+	found, err := discover(r.dataplane(), r.Protocol)
+	if err != nil {
+		log.Printf("Stale discovery incomplete: %v", err)
+	}
+
+	r.reconcileMu.Lock()
+	defer r.reconcileMu.Unlock()
+	r.initApplied()
+	r.graceUntil = time.Now().Add(r.GracePeriod)
+	for k, in := range found.ingress {
+		if _, ok := r.applied.ingress[k]; !ok {
+			r.applied.ingress[k] = in
+			r.stale["ingress/"+k] = struct{}{}
+		}
+	}
+	for k, e := range found.egress {
+		if _, ok := r.applied.egress[k]; !ok {
+			r.applied.egress[k] = e
+			r.stale["egress/"+k] = struct{}{}
+		}
+	}
+	for k, n := range found.neighbors {
+		if _, ok := r.applied.neighbors[k]; !ok {
+			r.applied.neighbors[k] = n
+			r.stale["neighbor/"+k] = struct{}{}
+		}
+	}
+	log.Printf("Marked stale: ingress=%d, egress=%d, neighbors=%d", len(found.ingress), len(found.egress), len(found.neighbors))
+}
+
+// retainStale reports whether an entry that is no longer desired must be kept
+// because it is stale and still within the grace period.
+func (r *Reconciler) retainStale(kind, key string) bool {
+	if _, ok := r.stale[kind+"/"+key]; !ok {
+		return false
+	}
+	return time.Now().Before(r.graceUntil)
+}
+
+func (r *Reconciler) Reconcile() error {
+	start := time.Now()
+	defer func() {
+		metrics.ReconcileDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	r.mu.Lock()
+	r.init()
+	ingress := maps.Clone(r.ingress)
+	egress := maps.Clone(r.egress)
+	requested := r.requested
+	r.requested = make(map[string]egressRoute)
+	r.mu.Unlock()
+
+	neighbors := make(map[string]neighborProxy)
+	for _, e := range egress {
+		if util.IsHost(e.prefix) {
+			n := neighborProxy{ip: e.prefix, vpc: e.vpc, vpcAttachment: e.vpcAttachment}
+			neighbors[n.key()] = n
+		}
+	}
+
+	r.reconcileMu.Lock()
+	defer r.reconcileMu.Unlock()
+	r.initApplied()
+
+	var errs []error
+	errs = append(errs, r.reconcileIngress(ingress)...)
+	errs = append(errs, r.reconcileNeighbors(neighbors)...)
+	errs = append(errs, r.reconcileEgress(egress, requested)...)
+	pending := len(r.pending)
+	for _, p := range r.neighPending {
+		if !p.expired {
+			pending++
+		}
+	}
+	r.pendingCount.Store(int32(pending))
+	r.updateMetrics()
+	return errors.Join(errs...)
+}
+
+func (r *Reconciler) updateMetrics() {
+	metrics.InstalledRoutes.Reset()
+	for _, in := range r.applied.ingress {
+		metrics.InstalledRoutes.WithLabelValues("ingress", util.GenerateInterfaceNameVRF(in.vpc, in.vpcAttachment)).Inc()
+	}
+	for _, e := range r.applied.egress {
+		metrics.InstalledRoutes.WithLabelValues("egress", util.GenerateInterfaceNameVRF(e.vpc, e.vpcAttachment)).Inc()
+	}
+	metrics.PendingRoutes.Set(float64(len(r.pending)))
+}
+
+// observe counts the outcome of a netlink operation.
+func observe(operation string, err error) error {
+	metrics.NetlinkOperations.WithLabelValues(operation, metrics.Result(err)).Inc()
+	return err
+}
+
+type attachment struct {
+	vpc           string
+	vpcAttachment string
+}
+
+func (r *Reconciler) reconcileIngress(desired map[string]ingressRoute) []error {
+	dp := r.dataplane()
+	var errs []error
+	for k, in := range r.applied.ingress {
+		if _, ok := desired[k]; ok || r.retainStale("ingress", k) {
+			continue
+		}
+		if err := observe("routeingress_delete", routeingress.Delete(dp, in.ip, in.vpc, in.vpcAttachment, r.Protocol)); err != nil && !isGone(dp, err, in.vpc, in.vpcAttachment) {
+			errs = append(errs, fmt.Errorf("routeingress delete failed: %s: %w", k, err))
+			continue
+		}
+		log.Printf("RECONCILE: removed ingress srv6_endpoint='%s'", in.ip.IP)
+		delete(r.applied.ingress, k)
+		delete(r.stale, "ingress/"+k)
+	}
+
+	kernel := make(map[attachment][]netlink.Route)
+	for k, in := range desired {
+		delete(r.stale, "ingress/"+k)
+		a := attachment{in.vpc, in.vpcAttachment}
+		routes, ok := kernel[a]
+		if !ok {
+			routes, _ = routeingress.List(dp, in.vpc, in.vpcAttachment, r.Protocol)
+			kernel[a] = routes
+		}
+		if slices.ContainsFunc(routes, func(route netlink.Route) bool {
+			return sameDst(route.Dst, in.ip)
+		}) {
+			r.applied.ingress[k] = in
+			continue
+		}
+		if err := observe("routeingress_add", routeingress.Add(dp, in.ip, in.vpc, in.vpcAttachment, r.Protocol)); err != nil {
+			errs = append(errs, fmt.Errorf("routeingress add failed: %s: %w", k, err))
+			continue
+		}
+		logInstall("ingress", k, r.applied.ingress[k].ip != nil)
+		r.applied.ingress[k] = in
+	}
+	return errs
+}
+
+// reconcileEgress reports the outcome of every route in requested once,
+// including routes that were already in place, are pending or were deleted
+// before being installed, and again once a failed one is retried
+// successfully.
+func (r *Reconciler) reconcileEgress(desired, requested map[string]egressRoute) []error {
+	dp := r.dataplane()
+	var errs []error
+	for k, e := range r.applied.egress {
+		_, req := requested[k]
+		if _, ok := desired[k]; ok || !req && r.retainStale("egress", k) {
+			continue
+		}
+		delete(requested, k)
+		if err := observe("routeegress_delete", routeegress.Delete(dp, e.vpc, e.vpcAttachment, e.prefix, e.segments, r.Protocol)); err != nil && !isGone(dp, err, e.vpc, e.vpcAttachment) {
+			r.notifyEgress(e, true, r.settle(k, req, err), err)
+			errs = append(errs, fmt.Errorf("routeegress delete failed: %s: %w", k, err))
+			continue
+		}
+		r.notifyEgress(e, true, r.settle(k, req, nil), nil)
+		log.Printf("RECONCILE: removed egress route='%s'", k)
+		delete(r.applied.egress, k)
+		delete(r.stale, "egress/"+k)
+	}
+
+	for k := range r.failed {
+		_, ok := desired[k]
+		if _, applied := r.applied.egress[k]; !ok && !applied {
+			delete(r.failed, k)
+		}
+	}
+
+	for k := range r.pending {
+		if _, ok := desired[k]; !ok {
+			delete(r.pending, k)
+		}
+	}
+
+	kernel := make(map[attachment][]netlink.Route)
+	for k, e := range desired {
+		_, req := requested[k]
+		delete(requested, k)
+		delete(r.stale, "egress/"+k)
+		a := attachment{e.vpc, e.vpcAttachment}
+		routes, ok := kernel[a]
+		if !ok {
+			routes, _ = routeegress.List(dp, e.vpc, e.vpcAttachment, r.Protocol)
+			kernel[a] = routes
+		}
+		if slices.ContainsFunc(routes, func(route netlink.Route) bool {
+			encap, ok := route.Encap.(*netlink.SEG6Encap)
+			return ok && sameDst(route.Dst, e.prefix) &&
+				encap.Mode == nl.SEG6_IPTUN_MODE_ENCAP &&
+				slices.EqualFunc(encap.Segments, e.segments, net.IP.Equal)
+		}) {
+			r.applied.egress[k] = e
+			if r.settle(k, req || r.pending[k].requested, nil) {
+				r.notifyEgress(e, false, true, nil)
+			}
+			delete(r.pending, k)
+			continue
+		}
+		if err := observe("routeegress_add", routeegress.Add(dp, e.vpc, e.vpcAttachment, e.prefix, e.segments, r.Protocol)); err != nil {
+			if errors.Is(err, dataplane.ErrLinkNotFound) {
+				r.holdPending(k, e, req, err)
+				continue
+			}
+			r.notifyEgress(e, false, r.settle(k, req, err), err)
+			errs = append(errs, fmt.Errorf("routeegress add failed: %s: %w", k, err))
+			continue
+		}
+		r.notifyEgress(e, false, r.settle(k, req || r.pending[k].requested, nil), nil)
+		delete(r.pending, k)
+		logInstall("egress", k, r.applied.egress[k].prefix != nil)
+		r.applied.egress[k] = e
+	}
+
+	// deleted before they were installed
+	for _, e := range requested {
+		r.notifyEgress(e, true, true, nil)
+	}
+	return errs
+}
+
+// holdPending keeps an egress route whose VRF or interface does not exist
+// yet pending until PendingTTL expires, then drops it from the desired state
+// and reports ErrPendingExpired. The outcome of a requested route is
+// reported once it is installed or expires.
+func (r *Reconciler) holdPending(k string, e egressRoute, requested bool, err error) {
+	ttl := r.pendingTTL()
+	p, ok := r.pending[k]
+	if !ok {
+		log.Printf("RECONCILE: pending egress route='%s': %v", k, err)
+		r.pending[k] = pendingRoute{since: time.Now(), requested: requested}
+		return
+	}
+	p.requested = p.requested || requested
+	if time.Since(p.since) < ttl {
+		r.pending[k] = p
+		return
+	}
+	delete(r.pending, k)
+	r.mu.Lock()
+	// unless it was replaced meanwhile
+	if desired, ok := r.egress[k]; ok && slices.EqualFunc(desired.segments, e.segments, net.IP.Equal) {
+		delete(r.egress, k)
+	}
+	r.mu.Unlock()
+	log.Printf("RECONCILE: dropped pending egress route='%s' after %s", k, ttl)
+	metrics.PendingRoutesExpired.Inc()
+	r.notifyEgress(e, false, p.requested, fmt.Errorf("%w after %s: %w", ErrPendingExpired, ttl, err))
+}
+
+// settle records the outcome of an attempt on egress route k and reports
+// whether it is requested: if the change was, or if it is the first success
+// after the requested change failed.
+func (r *Reconciler) settle(k string, requested bool, err error) bool {
+	if err != nil {
+		if requested {
+			r.failed[k] = struct{}{}
+		}
+		return requested
+	}
+	_, failed := r.failed[k]
+	delete(r.failed, k)
+	return requested || failed
+}
+
+func (r *Reconciler) pendingTTL() time.Duration {
+	if r.PendingTTL <= 0 {
+		return DefaultPendingTTL
+	}
+	return r.PendingTTL
+}
+
+func (r *Reconciler) notifyEgress(e egressRoute, del, requested bool, err error) {
+	if r.EgressHandler == nil {
+		return
+	}
+	vpc, vpcAttachment := e.hexIDs()
+	r.EgressHandler(EgressEvent{
+		VPC:           vpc,
+		VPCAttachment: vpcAttachment,
+		EgressRoute:   EgressRoute{Prefix: e.prefix, Segments: announced(e.segments)},
+		Delete:        del,
+		Requested:     requested,
+		Err:           err,
+	})
+}
+
+func (r *Reconciler) reconcileNeighbors(desired map[string]neighborProxy) []error {
+	dp := r.dataplane()
+	var errs []error
+	for k, n := range r.applied.neighbors {
+		if _, ok := desired[k]; ok || r.retainStale("neighbor", k) {
+			continue
+		}
+		if err := observe("neighborproxy_delete", neighborproxy.Delete(dp, n.ip, n.vpc, n.vpcAttachment)); err != nil && !isGone(dp, err, n.vpc, n.vpcAttachment) {
+			errs = append(errs, fmt.Errorf("neighborproxy delete failed: %s: %w", k, err))
+			continue
+		}
+		log.Printf("RECONCILE: removed neighbor proxy='%s'", k)
+		delete(r.applied.neighbors, k)
+		delete(r.stale, "neighbor/"+k)
+	}
+
+	for k := range r.neighPending {
+		if _, ok := desired[k]; !ok {
+			delete(r.neighPending, k)
+		}
+	}
+
+	kernel := make(map[attachment][]netlink.Neigh)
+	for k, n := range desired {
+		delete(r.stale, "neighbor/"+k)
+		a := attachment{n.vpc, n.vpcAttachment}
+		neighs, ok := kernel[a]
+		if !ok {
+			neighs, _ = neighborproxy.List(dp, n.vpc, n.vpcAttachment)
+			kernel[a] = neighs
+		}
+		if slices.ContainsFunc(neighs, func(neigh netlink.Neigh) bool {
+			return neigh.IP.Equal(n.ip.IP)
+		}) {
+			r.applied.neighbors[k] = n
+			delete(r.neighPending, k)
+			continue
+		}
+		if err := observe("neighborproxy_add", neighborproxy.Add(dp, n.ip, n.vpc, n.vpcAttachment)); err != nil {
+			if errors.Is(err, dataplane.ErrLinkNotFound) {
+				err = r.holdNeighbor(k, err)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("neighborproxy add failed: %s: %w", k, err))
+			}
+			continue
+		}
+		delete(r.neighPending, k)
+		logInstall("neighbor proxy", k, r.applied.neighbors[k].ip != nil)
+		r.applied.neighbors[k] = n
+	}
+	return errs
+}
+
+// holdNeighbor keeps a neighbor proxy whose host interface does not exist
+// yet pending until PendingTTL expires, then returns ErrPendingExpired once.
+// An expired proxy is still retried on every reconcile, but no longer when a
+// link appears.
+func (r *Reconciler) holdNeighbor(k string, err error) error {
+	ttl := r.pendingTTL()
+	p, ok := r.neighPending[k]
+	if !ok {
+		log.Printf("RECONCILE: pending neighbor proxy='%s': %v", k, err)
+		r.neighPending[k] = pendingNeighbor{since: time.Now()}
+		return nil
+	}
+	if p.expired || time.Since(p.since) < ttl {
+		return nil
+	}
+	p.expired = true
+	r.neighPending[k] = p
+	return fmt.Errorf("%w after %s: %w", ErrPendingExpired, ttl, err)
+}
+
+func logInstall(kind, key string, repaired bool) {
+	if repaired {
+		log.Printf("RECONCILE: repaired drifted %s='%s'", kind, key)
+	} else {
+		log.Printf("RECONCILE: installed %s='%s'", kind, key)
+	}
+}
+
+func sameDst(dst, want *net.IPNet) bool {
+	return dst != nil && dst.String() == want.String()
+}
+
+// isGone reports whether a delete failed only because the entry, its
+// interface or its VRF no longer exist, in which case there is nothing left
+// to remove.
+func isGone(dp dataplane.Dataplane, err error, vpc, vpcAttachment string) bool {
+	if errors.Is(err, unix.ESRCH) || errors.Is(err, unix.ENOENT) || errors.Is(err, dataplane.ErrLinkNotFound) {
+		return true
+	}
+	_, err = dp.LinkByName(util.GenerateInterfaceNameVRF(vpc, vpcAttachment))
+	return errors.Is(err, dataplane.ErrLinkNotFound)
+}
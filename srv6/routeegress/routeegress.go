@@ -6,18 +6,18 @@ import (
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
 
-	"github.com/datum-cloud/galactic-common/vrf"
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
 )
 
 const LoopbackDevice = "lo-galactic"
 
-func Add(vpc, vpcAttachment string, prefix *net.IPNet, segments []net.IP) error {
-	link, err := netlink.LinkByName(LoopbackDevice)
+func Add(dp dataplane.Dataplane, vpc, vpcAttachment string, prefix *net.IPNet, segments []net.IP, protocol netlink.RouteProtocol) error {
+	link, err := dp.LinkByName(LoopbackDevice)
 	if err != nil {
 		return err
 	}
 
-	vrfId, err := vrf.GetVRFIdForVPC(vpc, vpcAttachment)
+	vrfId, err := dataplane.GetVRFIdForVPC(dp, vpc, vpcAttachment)
 	if err != nil {
 		return err
 	}
@@ -31,17 +31,18 @@ func Add(vpc, vpcAttachment string, prefix *net.IPNet, segments []net.IP) error
 		Table:     int(vrfId),
 		LinkIndex: link.Attrs().Index,
 		Encap:     encap,
+		Protocol:  protocol,
 	}
-	return netlink.RouteReplace(route)
+	return dp.RouteReplace(route)
 }
 
-func Delete(vpc, vpcAttachment string, prefix *net.IPNet, segments []net.IP) error {
-	link, err := netlink.LinkByName(LoopbackDevice)
+func Delete(dp dataplane.Dataplane, vpc, vpcAttachment string, prefix *net.IPNet, segments []net.IP, protocol netlink.RouteProtocol) error {
+	link, err := dp.LinkByName(LoopbackDevice)
 	if err != nil {
 		return err
 	}
 
-	vrfId, err := vrf.GetVRFIdForVPC(vpc, vpcAttachment)
+	vrfId, err := dataplane.GetVRFIdForVPC(dp, vpc, vpcAttachment)
 	if err != nil {
 		return err
 	}
@@ -50,6 +51,38 @@ func Delete(vpc, vpcAttachment string, prefix *net.IPNet, segments []net.IP) err
 		Dst:       prefix,
 		Table:     int(vrfId),
 		LinkIndex: link.Attrs().Index,
+		Protocol:  protocol,
 	}
-	return netlink.RouteDel(route)
+	return dp.RouteDel(route)
+}
+
+func List(dp dataplane.Dataplane, vpc, vpcAttachment string, protocol netlink.RouteProtocol) ([]netlink.Route, error) {
+	link, err := dp.LinkByName(LoopbackDevice)
+	if err != nil {
+		return nil, err
+	}
+
+	vrfId, err := dataplane.GetVRFIdForVPC(dp, vpc, vpcAttachment)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &netlink.Route{
+		Table:     int(vrfId),
+		LinkIndex: link.Attrs().Index,
+		Protocol:  protocol,
+	}
+	var routes []netlink.Route
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		found, err := dp.RouteListFiltered(family, filter, netlink.RT_FILTER_TABLE|netlink.RT_FILTER_OIF|netlink.RT_FILTER_PROTOCOL)
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range found {
+			if _, ok := route.Encap.(*netlink.SEG6Encap); ok {
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes, nil
 }
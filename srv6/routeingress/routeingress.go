@@ -6,18 +6,18 @@ import (
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
 
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
 	"github.com/datum-cloud/galactic-common/util"
-	"github.com/datum-cloud/galactic-common/vrf"
 )
 
-func Add(ip *net.IPNet, vpc, vpcAttachment string) error {
+func Add(dp dataplane.Dataplane, ip *net.IPNet, vpc, vpcAttachment string, protocol netlink.RouteProtocol) error {
 	dev := util.GenerateInterfaceNameHost(vpc, vpcAttachment)
-	link, err := netlink.LinkByName(dev)
+	link, err := dp.LinkByName(dev)
 	if err != nil {
 		return err
 	}
 
-	vrfId, err := vrf.GetVRFIdForVPC(vpc, vpcAttachment)
+	vrfId, err := dataplane.GetVRFIdForVPC(dp, vpc, vpcAttachment)
 	if err != nil {
 		return err
 	}
@@ -34,13 +34,14 @@ func Add(ip *net.IPNet, vpc, vpcAttachment string) error {
 		Dst:       ip,
 		LinkIndex: link.Attrs().Index,
 		Encap:     encap,
+		Protocol:  protocol,
 	}
-	return netlink.RouteReplace(route)
+	return dp.RouteReplace(route)
 }
 
-func Delete(ip *net.IPNet, vpc, vpcAttachment string) error {
+func Delete(dp dataplane.Dataplane, ip *net.IPNet, vpc, vpcAttachment string, protocol netlink.RouteProtocol) error {
 	dev := util.GenerateInterfaceNameHost(vpc, vpcAttachment)
-	link, err := netlink.LinkByName(dev)
+	link, err := dp.LinkByName(dev)
 	if err != nil {
 		return err
 	}
@@ -49,6 +50,37 @@ func Delete(ip *net.IPNet, vpc, vpcAttachment string) error {
 		Dst:       ip,
 		LinkIndex: link.Attrs().Index,
 		Encap:     &netlink.SEG6LocalEncap{},
+		Protocol:  protocol,
 	}
-	return netlink.RouteDel(route)
+	return dp.RouteDel(route)
+}
+
+func List(dp dataplane.Dataplane, vpc, vpcAttachment string, protocol netlink.RouteProtocol) ([]netlink.Route, error) {
+	dev := util.GenerateInterfaceNameHost(vpc, vpcAttachment)
+	link, err := dp.LinkByName(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	vrfId, err := dataplane.GetVRFIdForVPC(dp, vpc, vpcAttachment)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := dp.RouteListFiltered(
+		netlink.FAMILY_V6,
+		&netlink.Route{LinkIndex: link.Attrs().Index, Protocol: protocol},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_PROTOCOL,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var routes []netlink.Route
+	for _, route := range found {
+		encap, ok := route.Encap.(*netlink.SEG6LocalEncap)
+		if ok && encap.Action == nl.SEG6_LOCAL_ACTION_END_DT46 && encap.VrfTable == int(vrfId) {
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
 }
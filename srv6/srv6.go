@@ -3,143 +3,415 @@ package srv6
 import (
 	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/vishvananda/netlink"
 
-	"github.com/datum-cloud/galactic-agent/srv6/neighborproxy"
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
 	"github.com/datum-cloud/galactic-agent/srv6/routeegress"
-	"github.com/datum-cloud/galactic-agent/srv6/routeingress"
 	"github.com/datum-cloud/galactic-common/util"
 )
 
-func RouteIngressAdd(ipStr string) error {
-	ip, err := util.ParseIP(ipStr)
-	if err != nil {
-		return fmt.Errorf("invalid ip: %w", err)
+type ingressRoute struct {
+	ip            *net.IPNet
+	vpc           string
+	vpcAttachment string
+}
+
+func (i ingressRoute) key() string {
+	return i.ip.String()
+}
+
+type egressRoute struct {
+	vpc           string
+	vpcAttachment string
+	prefix        *net.IPNet
+	segments      []net.IP
+}
+
+func (e egressRoute) key() string {
+	return fmt.Sprintf("%s/%s/%s", e.vpc, e.vpcAttachment, e.prefix)
+}
+
+// hexIDs returns the vpc and vpcattachment hex encoded, as accepted by
+// util.EncodeSRv6Endpoint.
+func (e egressRoute) hexIDs() (string, string) {
+	vpc, _ := util.Base62ToHex(e.vpc)
+	vpcAttachment, _ := util.Base62ToHex(e.vpcAttachment)
+	return fmt.Sprintf("%012s", vpc), fmt.Sprintf("%04s", vpcAttachment)
+}
+
+type neighborProxy struct {
+	ip            *net.IPNet
+	vpc           string
+	vpcAttachment string
+}
+
+func (n neighborProxy) key() string {
+	return fmt.Sprintf("%s/%s/%s", n.vpc, n.vpcAttachment, n.ip)
+}
+
+// Reconciler holds the desired SRv6 dataplane state. The Route* methods only
+// mutate the desired state; Run periodically diffs it against the kernel and
+// repairs any drift.
+//
+// Entries found in the kernel when Run starts are adopted as stale and are
+// only removed if they have not been re-confirmed once GracePeriod expires.
+type Reconciler struct {
+	// Dataplane defaults to the kernel.
+	Dataplane   dataplane.Dataplane
+	Interval    time.Duration
+	GracePeriod time.Duration
+	Protocol    netlink.RouteProtocol
+	// PendingTTL bounds how long an egress route whose VRF or interface, or
+	// a neighbor proxy whose host interface, does not exist yet is kept
+	// pending, defaults to DefaultPendingTTL. Pending entries are retried
+	// whenever a link appears.
+	PendingTTL time.Duration
+	// EgressHandler is called from the reconcile loop after every attempt
+	// to install or remove an egress route, except while a route is
+	// pending, and once for every requested change, see
+	// EgressEvent.Requested. It must not block.
+	EgressHandler func(EgressEvent)
+
+	mu      sync.Mutex
+	ingress map[string]ingressRoute
+	egress  map[string]egressRoute
+	// requested holds the egress routes changed since the last reconcile
+	requested map[string]egressRoute
+	trigger   chan struct{}
+
+	reconcileMu  sync.Mutex
+	applied      appliedState
+	stale        map[string]struct{}
+	graceUntil   time.Time
+	pending      map[string]pendingRoute
+	neighPending map[string]pendingNeighbor
+	// failed holds the egress routes whose requested change failed and
+	// was not retried successfully yet
+	failed       map[string]struct{}
+	pendingCount atomic.Int32
+}
+
+type pendingRoute struct {
+	// since is when the route first failed
+	since     time.Time
+	requested bool
+}
+
+type pendingNeighbor struct {
+	// since is when the neighbor proxy first failed
+	since   time.Time
+	expired bool
+}
+
+type appliedState struct {
+	ingress   map[string]ingressRoute
+	egress    map[string]egressRoute
+	neighbors map[string]neighborProxy
+}
+
+func (r *Reconciler) initApplied() {
+	if r.applied.ingress == nil {
+		r.applied.ingress = make(map[string]ingressRoute)
+		r.applied.egress = make(map[string]egressRoute)
+		r.applied.neighbors = make(map[string]neighborProxy)
+		r.stale = make(map[string]struct{})
+		r.pending = make(map[string]pendingRoute)
+		r.neighPending = make(map[string]pendingNeighbor)
+		r.failed = make(map[string]struct{})
+	}
+}
+
+func (r *Reconciler) dataplane() dataplane.Dataplane {
+	if r.Dataplane == nil {
+		return dataplane.Netlink{}
+	}
+	return r.Dataplane
+}
+
+func (r *Reconciler) init() {
+	if r.ingress == nil {
+		r.ingress = make(map[string]ingressRoute)
+		r.egress = make(map[string]egressRoute)
+		r.requested = make(map[string]egressRoute)
+		r.trigger = make(chan struct{}, 1)
 	}
+}
+
+func decodeEndpoint(ip net.IP) (string, string, error) {
 	vpc, vpcAttachment, err := util.DecodeSRv6Endpoint(ip)
 	if err != nil {
-		return fmt.Errorf("could not extract SRv6 endpoint: %w", err)
+		return "", "", fmt.Errorf("could not extract SRv6 endpoint: %w", err)
 	}
 	vpc, err = util.HexToBase62(vpc)
 	if err != nil {
-		return fmt.Errorf("invalid vpc: %w", err)
+		return "", "", fmt.Errorf("invalid vpc: %w", err)
 	}
 	vpcAttachment, err = util.HexToBase62(vpcAttachment)
 	if err != nil {
-		return fmt.Errorf("invalid vpcattachment: %w", err)
+		return "", "", fmt.Errorf("invalid vpcattachment: %w", err)
 	}
+	return vpc, vpcAttachment, nil
+}
 
-	if err := routeingress.Add(netlink.NewIPNet(ip), vpc, vpcAttachment); err != nil {
-		return fmt.Errorf("routeingress add failed: %w", err)
+func parseIngress(ipStr string) (ingressRoute, error) {
+	ip, err := util.ParseIP(ipStr)
+	if err != nil {
+		return ingressRoute{}, fmt.Errorf("invalid ip: %w", err)
 	}
-	return nil
+	vpc, vpcAttachment, err := decodeEndpoint(ip)
+	if err != nil {
+		return ingressRoute{}, err
+	}
+	return ingressRoute{
+		ip:            netlink.NewIPNet(ip),
+		vpc:           vpc,
+		vpcAttachment: vpcAttachment,
+	}, nil
 }
 
-func RouteIngressDel(ipStr string) error {
-	ip, err := util.ParseIP(ipStr)
+func parseEgress(prefixStr, srcStr string, segmentsStr []string) (egressRoute, error) {
+	prefix, err := netlink.ParseIPNet(prefixStr)
 	if err != nil {
-		return fmt.Errorf("invalid ip: %w", err)
+		return egressRoute{}, fmt.Errorf("invalid prefix: %w", err)
 	}
-	vpc, vpcAttachment, err := util.DecodeSRv6Endpoint(ip)
+	src, err := util.ParseIP(srcStr)
 	if err != nil {
-		return fmt.Errorf("could not extract SRv6 endpoint: %w", err)
+		return egressRoute{}, fmt.Errorf("invalid src: %w", err)
 	}
-	vpc, err = util.HexToBase62(vpc)
+	segments, err := util.ParseSegments(segmentsStr)
 	if err != nil {
-		return fmt.Errorf("invalid vpc: %w", err)
+		return egressRoute{}, fmt.Errorf("invalid segments: %w", err)
 	}
-	vpcAttachment, err = util.HexToBase62(vpcAttachment)
+	vpc, vpcAttachment, err := decodeEndpoint(src)
 	if err != nil {
-		return fmt.Errorf("invalid vpcattachment: %w", err)
+		return egressRoute{}, err
 	}
+	return egressRoute{
+		vpc:           vpc,
+		vpcAttachment: vpcAttachment,
+		prefix:        prefix,
+		segments:      segments,
+	}, nil
+}
 
-	if err := routeingress.Delete(netlink.NewIPNet(ip), vpc, vpcAttachment); err != nil {
-		return fmt.Errorf("routeingress delete failed: %w", err)
+func (r *Reconciler) RouteIngressAdd(ipStr string) error {
+	in, err := parseIngress(ipStr)
+	if err != nil {
+		return err
 	}
+	r.mu.Lock()
+	r.init()
+	r.ingress[in.key()] = in
+	r.mu.Unlock()
+	r.Trigger()
 	return nil
 }
 
-func RouteEgressAdd(prefixStr, srcStr string, segmentsStr []string) error {
-	prefix, err := netlink.ParseIPNet(prefixStr)
+func (r *Reconciler) RouteIngressDel(ipStr string) error {
+	in, err := parseIngress(ipStr)
 	if err != nil {
-		return fmt.Errorf("invalid prefix: %w", err)
+		return err
 	}
-	src, err := util.ParseIP(srcStr)
-	if err != nil {
-		return fmt.Errorf("invalid src: %w", err)
-	}
-	segments, err := util.ParseSegments(segmentsStr)
+	r.mu.Lock()
+	r.init()
+	delete(r.ingress, in.key())
+	r.mu.Unlock()
+	r.Trigger()
+	return nil
+}
+
+func (r *Reconciler) RouteEgressAdd(prefixStr, srcStr string, segmentsStr []string) error {
+	e, err := parseEgress(prefixStr, srcStr, segmentsStr)
 	if err != nil {
-		return fmt.Errorf("invalid segments: %w", err)
+		return err
 	}
+	r.mu.Lock()
+	r.init()
+	r.egress[e.key()] = e
+	r.requested[e.key()] = e
+	r.mu.Unlock()
+	r.Trigger()
+	return nil
+}
 
-	vpc, vpcAttachment, err := util.DecodeSRv6Endpoint(src)
+func (r *Reconciler) RouteEgressDel(prefixStr, srcStr string, segmentsStr []string) error {
+	e, err := parseEgress(prefixStr, srcStr, segmentsStr)
 	if err != nil {
-		return fmt.Errorf("could not extract SRv6 endpoint: %w", err)
+		return err
 	}
-	vpc, err = util.HexToBase62(vpc)
+	r.mu.Lock()
+	r.init()
+	delete(r.egress, e.key())
+	r.requested[e.key()] = e
+	r.mu.Unlock()
+	r.Trigger()
+	return nil
+}
+
+// RouteEgressFlush removes every egress route of the attachment with the
+// SRv6 endpoint ipStr, e.g. once it is deregistered. Unlike RouteEgressDel
+// the removals are not requested changes.
+func (r *Reconciler) RouteEgressFlush(ipStr string) error {
+	in, err := parseIngress(ipStr)
 	if err != nil {
-		return fmt.Errorf("invalid vpc: %w", err)
+		return err
 	}
-	vpcAttachment, err = util.HexToBase62(vpcAttachment)
-	if err != nil {
-		return fmt.Errorf("invalid vpcattachment: %w", err)
+	r.mu.Lock()
+	r.init()
+	for k, e := range r.egress {
+		if e.vpc == in.vpc && e.vpcAttachment == in.vpcAttachment {
+			delete(r.egress, k)
+		}
 	}
+	r.mu.Unlock()
+	r.Trigger()
+	return nil
+}
+
+type EgressSpec struct {
+	Prefix   string   `json:"network"`
+	Src      string   `json:"srv6_endpoint"`
+	Segments []string `json:"srv6_segments"`
+}
+
+// Validate reports whether the route can be installed as specified.
+func (s EgressSpec) Validate() error {
+	_, err := parseEgress(s.Prefix, s.Src, s.Segments)
+	return err
+}
 
+// SetEgress replaces the whole desired egress state, e.g. with a snapshot
+// received from the controller. Invalid routes are skipped and reported.
+func (r *Reconciler) SetEgress(specs []EgressSpec) error {
+	egress := make(map[string]egressRoute, len(specs))
 	var errs []error
-	if util.IsHost(prefix) {
-		if err := neighborproxy.Add(prefix, vpc, vpcAttachment); err != nil {
-			errs = append(errs, fmt.Errorf("neighborproxy add failed: %w", err))
+	for _, spec := range specs {
+		e, err := parseEgress(spec.Prefix, spec.Src, spec.Segments)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("route '%s' via '%s': %w", spec.Prefix, spec.Src, err))
+			continue
 		}
+		egress[e.key()] = e
 	}
-	if err := routeegress.Add(vpc, vpcAttachment, prefix, segments); err != nil {
-		errs = append(errs, fmt.Errorf("routeegress add failed: %w", err))
+	r.mu.Lock()
+	r.init()
+	// only routes the snapshot changes are requested
+	for k, e := range egress {
+		if old, ok := r.egress[k]; !ok || !slices.EqualFunc(old.segments, e.segments, net.IP.Equal) {
+			r.requested[k] = e
+		}
 	}
-	if len(errs) > 0 {
-		return errors.Join(errs...)
+	for k, e := range r.egress {
+		if _, ok := egress[k]; !ok {
+			r.requested[k] = e
+		}
 	}
-	return nil
+	r.egress = egress
+	r.mu.Unlock()
+	r.Trigger()
+	return errors.Join(errs...)
 }
 
-func RouteEgressDel(prefixStr, srcStr string, segmentsStr []string) error {
-	prefix, err := netlink.ParseIPNet(prefixStr)
-	if err != nil {
-		return fmt.Errorf("invalid prefix: %w", err)
+// Trigger schedules a reconcile without waiting for the next interval.
+func (r *Reconciler) Trigger() {
+	r.mu.Lock()
+	r.init()
+	trigger := r.trigger
+	r.mu.Unlock()
+	select {
+	case trigger <- struct{}{}:
+	default:
 	}
-	src, err := util.ParseIP(srcStr)
+}
+
+type EgressRoute struct {
+	Prefix   *net.IPNet
+	Segments []net.IP
+}
+
+type EgressEvent struct {
+	// VPC and VPCAttachment are hex encoded, as decoded from the SRv6 endpoint.
+	VPC           string
+	VPCAttachment string
+	EgressRoute
+	Delete bool
+	// Requested is set on the first outcome of a route after it was
+	// changed with RouteEgressAdd, RouteEgressDel or SetEgress, including
+	// routes that were already in place, and on the first success of a
+	// retry after that outcome was a failure. Other retries and drift
+	// repairs are not requested.
+	Requested bool
+	Err       error
+}
+
+// Egress returns the VRF table of an attachment and the egress routes
+// currently installed in it. vpc and vpcAttachment are hex encoded, as
+// accepted by util.EncodeSRv6Endpoint.
+func (r *Reconciler) Egress(vpc, vpcAttachment string) (uint32, []EgressRoute, error) {
+	vpc, err := util.HexToBase62(vpc)
 	if err != nil {
-		return fmt.Errorf("invalid src: %w", err)
+		return 0, nil, fmt.Errorf("invalid vpc: %w", err)
 	}
-	segments, err := util.ParseSegments(segmentsStr)
+	vpcAttachment, err = util.HexToBase62(vpcAttachment)
 	if err != nil {
-		return fmt.Errorf("invalid segments: %w", err)
+		return 0, nil, fmt.Errorf("invalid vpcattachment: %w", err)
 	}
 
-	vpc, vpcAttachment, err := util.DecodeSRv6Endpoint(src)
-	if err != nil {
-		return fmt.Errorf("could not extract SRv6 endpoint: %w", err)
-	}
-	vpc, err = util.HexToBase62(vpc)
+	vrfId, err := dataplane.GetVRFIdForVPC(r.dataplane(), vpc, vpcAttachment)
 	if err != nil {
-		return fmt.Errorf("invalid vpc: %w", err)
+		return 0, nil, err
 	}
-	vpcAttachment, err = util.HexToBase62(vpcAttachment)
+	routes, err := routeegress.List(r.dataplane(), vpc, vpcAttachment, r.Protocol)
 	if err != nil {
-		return fmt.Errorf("invalid vpcattachment: %w", err)
+		return 0, nil, fmt.Errorf("routeegress list failed: %w", err)
 	}
 
-	var errs []error
-	if util.IsHost(prefix) {
-		if err := neighborproxy.Delete(prefix, vpc, vpcAttachment); err != nil {
-			errs = append(errs, fmt.Errorf("neighborproxy delete failed: %w", err))
+	egress := make([]EgressRoute, 0, len(routes))
+	for _, route := range routes {
+		if route.Dst == nil {
+			continue
 		}
+		segments := announced(route.Encap.(*netlink.SEG6Encap).Segments)
+		egress = append(egress, EgressRoute{Prefix: route.Dst, Segments: segments})
 	}
-	if err := routeegress.Delete(vpc, vpcAttachment, prefix, segments); err != nil {
-		errs = append(errs, fmt.Errorf("routeegress delete failed: %w", err))
-	}
-	if len(errs) > 0 {
-		return errors.Join(errs...)
+	return vrfId, egress, nil
+}
+
+// AttachmentRoute is an egress route of an attachment. VPC and
+// VPCAttachment are hex encoded, as accepted by util.EncodeSRv6Endpoint.
+type AttachmentRoute struct {
+	VPC           string
+	VPCAttachment string
+	EgressRoute
+}
+
+// AppliedEgress returns the egress routes installed in the dataplane as of
+// the last reconcile, including stale routes adopted at startup.
+func (r *Reconciler) AppliedEgress() []AttachmentRoute {
+	r.reconcileMu.Lock()
+	defer r.reconcileMu.Unlock()
+	routes := make([]AttachmentRoute, 0, len(r.applied.egress))
+	for _, e := range r.applied.egress {
+		vpc, vpcAttachment := e.hexIDs()
+		routes = append(routes, AttachmentRoute{
+			VPC:           vpc,
+			VPCAttachment: vpcAttachment,
+			EgressRoute:   EgressRoute{Prefix: e.prefix, Segments: announced(e.segments)},
+		})
 	}
-	return nil
+	return routes
+}
+
+// announced returns segments in the order they were received from the
+// controller, undoing the reversal done by util.ParseSegments.
+func announced(segments []net.IP) []net.IP {
+	segments = slices.Clone(segments)
+	slices.Reverse(segments)
+	return segments
 }
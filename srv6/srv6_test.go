@@ -0,0 +1,487 @@
+package srv6_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/datum-cloud/galactic-agent/srv6"
+	"github.com/datum-cloud/galactic-agent/srv6/dataplane"
+	"github.com/datum-cloud/galactic-agent/srv6/routeegress"
+	"github.com/datum-cloud/galactic-common/util"
+)
+
+const (
+	srv6Net       = "fc00::/56"
+	vpc           = "0000000004d2" // jU in base62
+	vpcAttachment = "002a"         // G in base62
+	vrfTable      = 10
+)
+
+var segments = []string{"2607:ed40:ff00::1", "2607:ed40:ff01::1"}
+
+func newFake(t *testing.T, errs map[string]error) (*dataplane.Fake, string) {
+	t.Helper()
+	f := &dataplane.Fake{Errs: errs}
+	f.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: routeegress.LoopbackDevice}})
+	f.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameHost("jU", "G")}})
+	f.AddLink(&netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameVRF("jU", "G")}, Table: vrfTable})
+	endpoint, err := util.EncodeSRv6Endpoint(srv6Net, vpc, vpcAttachment)
+	if err != nil {
+		t.Fatalf("EncodeSRv6Endpoint() error = %v", err)
+	}
+	return f, endpoint
+}
+
+func TestRouteEgressAddDel(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefix    string
+		wantNeigh bool
+		wantError bool
+	}{
+		{"HostIPv6", "2001:db8::1/128", true, false},
+		{"HostIPv4", "10.0.0.1/32", true, false},
+		{"NetworkIPv6", "2001:db8::/64", false, false},
+		{"NetworkIPv4", "10.0.0.0/24", false, false},
+		{"InvalidPrefix", "not_a_prefix", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, endpoint := newFake(t, nil)
+			rc := &srv6.Reconciler{Dataplane: f, Protocol: srv6.DefaultProtocol}
+
+			err := rc.RouteEgressAdd(tt.prefix, endpoint, segments)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("RouteEgressAdd() error = %v, wantError = %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+			if err := rc.Reconcile(); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			routes := f.Routes()
+			if len(routes) != 1 {
+				t.Fatalf("Routes() got %d routes, want 1", len(routes))
+			}
+			route := routes[0]
+			if route.Dst.String() != tt.prefix || route.Table != vrfTable || route.Protocol != srv6.DefaultProtocol {
+				t.Errorf("route = %s table %d proto %d, want %s table %d proto %d", route.Dst, route.Table, route.Protocol, tt.prefix, vrfTable, srv6.DefaultProtocol)
+			}
+			wantSegments, _ := util.ParseSegments(segments)
+			encap, ok := route.Encap.(*netlink.SEG6Encap)
+			if !ok || encap.Mode != nl.SEG6_IPTUN_MODE_ENCAP || !reflect.DeepEqual(encap.Segments, wantSegments) {
+				t.Errorf("route encap = %v, want encap segments %v", route.Encap, wantSegments)
+			}
+			if got := len(f.Neighs()) == 1; got != tt.wantNeigh {
+				t.Errorf("Neighs() = %v, wantNeigh = %v", f.Neighs(), tt.wantNeigh)
+			}
+
+			if err := rc.RouteEgressDel(tt.prefix, endpoint, segments); err != nil {
+				t.Fatalf("RouteEgressDel() error = %v", err)
+			}
+			if err := rc.Reconcile(); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if len(f.Routes()) != 0 || len(f.Neighs()) != 0 {
+				t.Errorf("after delete got routes = %v, neighs = %v, want none", f.Routes(), f.Neighs())
+			}
+		})
+	}
+}
+
+func TestRouteEgressAddErrors(t *testing.T) {
+	errNeigh := errors.New("neigh failed")
+	errRoute := errors.New("route failed")
+	tests := []struct {
+		name       string
+		prefix     string
+		errs       map[string]error
+		wantErrors []error
+		wantRoutes int
+	}{
+		{"NoErrors", "2001:db8::1/128", nil, nil, 1},
+		{"NeighborProxy", "2001:db8::1/128", map[string]error{"NeighAdd": errNeigh}, []error{errNeigh}, 1},
+		{"NeighborProxyNonHost", "2001:db8::/64", map[string]error{"NeighAdd": errNeigh}, nil, 1},
+		{"Route", "2001:db8::1/128", map[string]error{"RouteReplace": errRoute}, []error{errRoute}, 0},
+		{"Both", "2001:db8::1/128", map[string]error{"NeighAdd": errNeigh, "RouteReplace": errRoute}, []error{errNeigh, errRoute}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, endpoint := newFake(t, tt.errs)
+			rc := &srv6.Reconciler{Dataplane: f, Protocol: srv6.DefaultProtocol}
+			if err := rc.RouteEgressAdd(tt.prefix, endpoint, segments); err != nil {
+				t.Fatalf("RouteEgressAdd() error = %v", err)
+			}
+
+			err := rc.Reconcile()
+			if (err != nil) != (len(tt.wantErrors) > 0) {
+				t.Fatalf("Reconcile() error = %v, want %v", err, tt.wantErrors)
+			}
+			for _, want := range tt.wantErrors {
+				if !errors.Is(err, want) {
+					t.Errorf("Reconcile() error = %v, want it to wrap %v", err, want)
+				}
+			}
+			if got := len(f.Routes()); got != tt.wantRoutes {
+				t.Errorf("Routes() got %d routes, want %d", got, tt.wantRoutes)
+			}
+		})
+	}
+}
+
+func TestRouteIngressAddDel(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		wantError bool
+	}{
+		{"Valid", "", false},
+		{"InvalidIP", "not_an_ip", true},
+		{"IPv4Endpoint", "192.168.0.1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, endpoint := newFake(t, nil)
+			if tt.endpoint != "" {
+				endpoint = tt.endpoint
+			}
+			rc := &srv6.Reconciler{Dataplane: f, Protocol: srv6.DefaultProtocol}
+
+			err := rc.RouteIngressAdd(endpoint)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("RouteIngressAdd() error = %v, wantError = %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+			if err := rc.Reconcile(); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			host, _ := f.LinkByName(util.GenerateInterfaceNameHost("jU", "G"))
+			routes := f.Routes()
+			if len(routes) != 1 {
+				t.Fatalf("Routes() got %d routes, want 1", len(routes))
+			}
+			route := routes[0]
+			encap, ok := route.Encap.(*netlink.SEG6LocalEncap)
+			if !ok || encap.Action != nl.SEG6_LOCAL_ACTION_END_DT46 || encap.VrfTable != vrfTable {
+				t.Errorf("route encap = %v, want End.DT46 into table %d", route.Encap, vrfTable)
+			}
+			if !route.Dst.IP.Equal(net.ParseIP(endpoint)) || route.LinkIndex != host.Attrs().Index {
+				t.Errorf("route = %s dev %d, want %s dev %d", route.Dst, route.LinkIndex, endpoint, host.Attrs().Index)
+			}
+
+			if err := rc.RouteIngressDel(endpoint); err != nil {
+				t.Fatalf("RouteIngressDel() error = %v", err)
+			}
+			if err := rc.Reconcile(); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if len(f.Routes()) != 0 {
+				t.Errorf("after delete got routes = %v, want none", f.Routes())
+			}
+		})
+	}
+}
+
+func TestReconcileRepairsDrift(t *testing.T) {
+	f, endpoint := newFake(t, nil)
+	rc := &srv6.Reconciler{Dataplane: f, Protocol: srv6.DefaultProtocol}
+	if err := rc.RouteEgressAdd("2001:db8::/64", endpoint, segments); err != nil {
+		t.Fatalf("RouteEgressAdd() error = %v", err)
+	}
+	if err := rc.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	route := f.Routes()[0]
+	if err := f.RouteDel(&route); err != nil {
+		t.Fatalf("RouteDel() error = %v", err)
+	}
+	if err := rc.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := f.Routes(); len(got) != 1 || !strings.HasPrefix(got[0].Dst.String(), "2001:db8::") {
+		t.Errorf("Routes() = %v, want the deleted route restored", got)
+	}
+}
+
+func TestReconcileRetryRequested(t *testing.T) {
+	f, endpoint := newFake(t, map[string]error{"RouteReplace": errors.New("route failed")})
+	var events []srv6.EgressEvent
+	rc := &srv6.Reconciler{
+		Dataplane:     f,
+		Protocol:      srv6.DefaultProtocol,
+		EgressHandler: func(e srv6.EgressEvent) { events = append(events, e) },
+	}
+	if err := rc.RouteEgressAdd("2001:db8::/64", endpoint, segments); err != nil {
+		t.Fatalf("RouteEgressAdd() error = %v", err)
+	}
+	for range 2 {
+		rc.Reconcile() //nolint:errcheck
+	}
+	f.SetErr("RouteReplace", nil)
+	for range 2 {
+		if err := rc.Reconcile(); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+
+	// the change, its failed retry and its first successful retry
+	var got []bool
+	for _, e := range events {
+		got = append(got, e.Requested)
+	}
+	if want := []bool{true, false, true}; !slices.Equal(got, want) || events[2].Err != nil {
+		t.Errorf("EgressEvents requested = %v, want %v ending in a success", got, want)
+	}
+}
+
+func TestReconcilePendingRoute(t *testing.T) {
+	f := &dataplane.Fake{}
+	f.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: routeegress.LoopbackDevice}})
+	endpoint, err := util.EncodeSRv6Endpoint(srv6Net, vpc, vpcAttachment)
+	if err != nil {
+		t.Fatalf("EncodeSRv6Endpoint() error = %v", err)
+	}
+	events := make(chan srv6.EgressEvent, 10)
+	rc := &srv6.Reconciler{
+		Dataplane:     f,
+		Interval:      time.Hour,
+		Protocol:      srv6.DefaultProtocol,
+		EgressHandler: func(e srv6.EgressEvent) { events <- e },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- rc.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}()
+
+	// the route arrives before the VRF of its attachment exists
+	if err := rc.RouteEgressAdd("2001:db8::/64", endpoint, segments); err != nil {
+		t.Fatalf("RouteEgressAdd() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(events) != 0 || len(f.Routes()) != 0 {
+		t.Fatalf("pending route reported or installed")
+	}
+
+	f.AddLink(&netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameVRF("jU", "G")}, Table: vrfTable})
+	select {
+	case e := <-events:
+		if e.Err != nil {
+			t.Errorf("EgressEvent error = %v", e.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("pending route not installed once the VRF appeared")
+	}
+	if got := len(f.Routes()); got != 1 {
+		t.Errorf("Routes() got %d routes, want 1", got)
+	}
+}
+
+func TestReconcilePendingRouteExpires(t *testing.T) {
+	f := &dataplane.Fake{}
+	f.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: routeegress.LoopbackDevice}})
+	endpoint, err := util.EncodeSRv6Endpoint(srv6Net, vpc, vpcAttachment)
+	if err != nil {
+		t.Fatalf("EncodeSRv6Endpoint() error = %v", err)
+	}
+	var events []srv6.EgressEvent
+	rc := &srv6.Reconciler{
+		Dataplane:     f,
+		Protocol:      srv6.DefaultProtocol,
+		PendingTTL:    time.Millisecond,
+		EgressHandler: func(e srv6.EgressEvent) { events = append(events, e) },
+	}
+	if err := rc.RouteEgressAdd("2001:db8::/64", endpoint, segments); err != nil {
+		t.Fatalf("RouteEgressAdd() error = %v", err)
+	}
+	for range 2 {
+		if err := rc.Reconcile(); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if len(events) != 1 || !errors.Is(events[0].Err, srv6.ErrPendingExpired) {
+		t.Fatalf("EgressEvents = %v, want one with %v", events, srv6.ErrPendingExpired)
+	}
+
+	// dropped from the desired state, the VRF appearing later changes nothing
+	f.AddLink(&netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameVRF("jU", "G")}, Table: vrfTable})
+	if err := rc.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := len(f.Routes()); got != 0 {
+		t.Errorf("Routes() got %d routes, want 0", got)
+	}
+}
+
+func TestReconcilePendingNeighbor(t *testing.T) {
+	f := &dataplane.Fake{}
+	f.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: routeegress.LoopbackDevice}})
+	f.AddLink(&netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameVRF("jU", "G")}, Table: vrfTable})
+	endpoint, err := util.EncodeSRv6Endpoint(srv6Net, vpc, vpcAttachment)
+	if err != nil {
+		t.Fatalf("EncodeSRv6Endpoint() error = %v", err)
+	}
+	rc := &srv6.Reconciler{
+		Dataplane: f,
+		Interval:  time.Hour,
+		Protocol:  srv6.DefaultProtocol,
+	}
+	// the host interface of the attachment does not exist yet
+	if err := rc.RouteEgressAdd("2001:db8::1/128", endpoint, segments); err != nil {
+		t.Fatalf("RouteEgressAdd() error = %v", err)
+	}
+	for range 2 {
+		if err := rc.Reconcile(); err != nil {
+			t.Fatalf("Reconcile() error = %v, want none while pending", err)
+		}
+	}
+	if len(f.Routes()) != 1 || len(f.Neighs()) != 0 {
+		t.Fatalf("got %d routes and %d neighbors, want 1 and 0", len(f.Routes()), len(f.Neighs()))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- rc.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	f.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameHost("jU", "G")}})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(f.Neighs()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pending neighbor proxy not installed once the host interface appeared")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReconcilePendingNeighborExpires(t *testing.T) {
+	f := &dataplane.Fake{}
+	f.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: routeegress.LoopbackDevice}})
+	f.AddLink(&netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameVRF("jU", "G")}, Table: vrfTable})
+	endpoint, err := util.EncodeSRv6Endpoint(srv6Net, vpc, vpcAttachment)
+	if err != nil {
+		t.Fatalf("EncodeSRv6Endpoint() error = %v", err)
+	}
+	rc := &srv6.Reconciler{
+		Dataplane:  f,
+		Protocol:   srv6.DefaultProtocol,
+		PendingTTL: time.Millisecond,
+	}
+	if err := rc.RouteEgressAdd("2001:db8::1/128", endpoint, segments); err != nil {
+		t.Fatalf("RouteEgressAdd() error = %v", err)
+	}
+	// reported once when the TTL expires
+	var expired int
+	for range 3 {
+		if err := rc.Reconcile(); errors.Is(err, srv6.ErrPendingExpired) {
+			expired++
+		} else if err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if expired != 1 {
+		t.Errorf("Reconcile() reported %d expiries, want 1", expired)
+	}
+
+	// still retried on every reconcile
+	f.AddLink(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: util.GenerateInterfaceNameHost("jU", "G")}})
+	if err := rc.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := len(f.Neighs()); got != 1 {
+		t.Errorf("Neighs() got %d neighbors, want 1", got)
+	}
+}
+
+func TestReconcileStaleGracePeriod(t *testing.T) {
+	f, endpoint := newFake(t, nil)
+	previous := &srv6.Reconciler{Dataplane: f, Protocol: srv6.DefaultProtocol}
+	for _, prefix := range []string{"2001:db8:1::/64", "2001:db8:2::/64"} {
+		if err := previous.RouteEgressAdd(prefix, endpoint, segments); err != nil {
+			t.Fatalf("RouteEgressAdd() error = %v", err)
+		}
+	}
+	if err := previous.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	installed := func(prefix string) bool {
+		for _, route := range f.Routes() {
+			if route.Dst.String() == prefix {
+				return true
+			}
+		}
+		return false
+	}
+
+	// a restarted agent adopts both routes as stale
+	rc := &srv6.Reconciler{
+		Dataplane:   f,
+		Interval:    10 * time.Millisecond,
+		GracePeriod: 200 * time.Millisecond,
+		Protocol:    srv6.DefaultProtocol,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- rc.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if !installed("2001:db8:1::/64") || !installed("2001:db8:2::/64") {
+		t.Fatalf("stale routes removed within the grace period: %v", f.Routes())
+	}
+	if err := rc.RouteEgressAdd("2001:db8:1::/64", endpoint, segments); err != nil {
+		t.Fatalf("RouteEgressAdd() error = %v", err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for installed("2001:db8:2::/64") {
+		select {
+		case <-deadline:
+			t.Fatalf("unconfirmed stale route not removed after the grace period")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if !installed("2001:db8:1::/64") {
+		t.Errorf("re-confirmed stale route removed")
+	}
+}